@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/dropbox"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/messages"
+)
+
+// pendingLogin is the login started by the listener's auth command, waiting for its code
+var pendingLogin *dropbox.Login
+
+// authCommand logs in with Dropbox, saving the credentials so the access
+// token can be refreshed as it expires
+func authCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dropbox-gif-linker auth")
+		return exitUsage
+	}
+	if err := setupReadOnly(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	login, err := dropboxClient.NewLogin()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	fmt.Printf("1. Go to %v\n", login.URL())
+	fmt.Println("2. Click Allow (you might have to log in first)")
+	fmt.Print("3. Enter the authorization code here: ")
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && code == "" {
+		fmt.Fprintln(os.Stderr, "\nno code entered")
+		return exitUsage
+	}
+	if err = dropboxClient.Login(context.Background(), login, code); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Printf("Logged in. Credentials saved to %v\n", dropboxClient.Config.CredentialsPath())
+	return exitOK
+}
+
+// auth starts logging in from the listener, or finishes it with the code
+func auth(code string) {
+	code = strings.TrimSpace(code)
+	if code != "" && pendingLogin == nil {
+		fmt.Println(messages.Sad("There's no login in progress for that code. Run auth first to start one"))
+		return
+	}
+	if code == "" {
+		login, err := dropboxClient.NewLogin()
+		if err != nil {
+			fmt.Println(messages.Error("Unable to log in", err))
+			return
+		}
+		pendingLogin = &login
+		fmt.Println(messages.Info(fmt.Sprintf("Go to %v", login.URL())))
+		fmt.Println(messages.Info("Click Allow, then enter auth and the code Dropbox shows you"))
+		return
+	}
+	if err := dropboxClient.Login(context.Background(), *pendingLogin, code); err != nil {
+		fmt.Println(messages.Error("Unable to log in", err))
+		return
+	}
+	pendingLogin = nil
+	fmt.Println(messages.Happy("Logged in to Dropbox"))
+}
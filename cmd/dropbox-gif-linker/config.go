@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/dropbox"
+)
+
+// configCommand shows the loaded config, and where each setting came from
+func configCommand(args []string) int {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	sources := flags.Bool("sources", false, "show where each setting came from")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker config [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	config, err := dropbox.NewConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	fmt.Println(settingsMessage(config.Settings(), *sources))
+	return exitOK
+}
+
+// settingsMessage lists the settings, with where each came from when asked
+func settingsMessage(settings []dropbox.Setting, sources bool) string {
+	path, reason := dropbox.ConfigFile()
+	message := fmt.Sprintf("Config File: %v (%v)\n", path, reason)
+	width, valueWidth := 0, 0
+	for _, s := range settings {
+		if len(s.Key) > width {
+			width = len(s.Key)
+		}
+		if len(s.Value) > valueWidth {
+			valueWidth = len(s.Value)
+		}
+	}
+	for _, s := range settings {
+		if sources {
+			message += fmt.Sprintf("- %-*v  %-*v  %v\n", width, s.Key, valueWidth, s.Value, s.Source)
+		} else {
+			message += fmt.Sprintf("- %-*v  %v\n", width, s.Key, s.Value)
+		}
+	}
+	return strings.TrimSuffix(message, "\n")
+}
+
+// showConfig reports the config from the listener, with where each setting came
+// from when asked
+func showConfig(args string) string {
+	if args == "sources" || args == "--sources" {
+		return settingsMessage(dropboxClient.Config.Settings(), true)
+	}
+	return configMessage()
+}
+
+// globalFlags applies the --config and --profile flags that can come before a
+// subcommand, returning the rest
+func globalFlags(args []string) (rest []string, err error) {
+	for len(args) > 0 {
+		name, value := args[0], ""
+		hasValue := false
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value, hasValue = name[:i], name[i+1:], true
+		}
+		var apply func(string)
+		var needs string
+		switch name {
+		case "--config", "-config":
+			apply, needs = dropbox.SetConfigPath, "the path to a config file"
+		case "--profile", "-profile":
+			apply, needs = dropbox.SetProfile, "the name of a profile"
+		}
+		if apply == nil {
+			break
+		}
+		if !hasValue {
+			if len(args) < 2 || args[1] == "" {
+				return nil, fmt.Errorf("%v needs %v", name, needs)
+			}
+			value, args = args[1], args[1:]
+		}
+		apply(value)
+		args = args[1:]
+	}
+	return args, nil
+}
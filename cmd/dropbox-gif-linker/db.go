@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+// dbCommand runs database maintenance tasks
+func dbCommand(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: dropbox-gif-linker db <migrate [--dry-run]|reindex>")
+	}
+	if len(args) == 0 {
+		usage()
+		return exitUsage
+	}
+	switch args[0] {
+	case "migrate":
+		return migrateCommand(args[1:])
+	case "reindex":
+		return reindexCommand(args[1:])
+	}
+	usage()
+	return exitUsage
+}
+
+// migrateCommand upgrades the database schema, or reports what would change
+func migrateCommand(args []string) int {
+	flags := flag.NewFlagSet("db migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing anything")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if err := setupWith(gifkv.InitWithoutMigrations); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	report, err := gifkv.Migrate(*dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Println(report)
+	if *dryRun && len(report.Steps) > 0 {
+		fmt.Println("Dry run: no changes were written.")
+	}
+	return exitOK
+}
+
+// reindexCommand regenerates the secondary indexes
+func reindexCommand(args []string) int {
+	if err := setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	count, err := gifkv.RebuildIndexes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Printf("Indexed %d records\n", count)
+	return exitOK
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	clear "github.com/dmowcomber/go-clear"
 	humanize "github.com/dustin/go-humanize"
@@ -13,67 +17,153 @@ import (
 	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/commands"
 	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/data"
 	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/dropbox"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/formats"
 	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/history"
 	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/messages"
 	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/taylor"
 	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/version"
 )
 
 var dropboxClient dropbox.Client
+var handler = data.NewHandler()
 var mode = "url"
 
-func url() bool {
-	return mode == "url"
+// results holds the latest numbered list of records, for picking by number
+var results []gifkv.Record
+
+// current holds the records most recently copied, for mode shifts and deletion
+var current []gifkv.Record
+
+// session holds the records processed since startup
+var session = history.New(historyLimit)
+
+// pasteDelay is how long to wait for more lines when several paths are pasted
+var pasteDelay = 50 * time.Millisecond
+
+// stepError ties an error to the step of the linking process that failed
+type stepError struct {
+	step string
+	err  error
 }
 
-func md() bool {
-	return mode == "md"
+func (e stepError) Error() string {
+	return fmt.Sprintf("%v: %v", e.step, e.err)
 }
 
-func bbcode() bool {
-	return mode == "bbcode"
+func (e stepError) Unwrap() error {
+	return e.err
 }
 
-func handleFirstArg(argument string) {
-	if os.Args[1] == "version" || os.Args[1] == "--version" {
-		fmt.Println(version.Full())
-		os.Exit(0)
-	}
+// subcommands run once and exit instead of starting the listener
+var subcommands = map[string]func(args []string) int{
+	"link":          linkCommand,
+	"search":        searchCommand,
+	"index":         indexCommand,
+	"db":            dbCommand,
+	"sync":          syncCommand,
+	"verify":        verifyCommand,
+	"init":          initCommand,
+	"config":        configCommand,
+	"auth":          authCommand,
+	"encrypt-token": encryptTokenCommand,
+	"export":        exportCommand,
+	"import":        importCommand,
+	"version":       versionCommand,
+	"--version":     versionCommand,
+}
 
-	if os.Args[1] == "md" || os.Args[1] == "markdown" {
-		mode = "md"
-	}
+func versionCommand(args []string) int {
+	fmt.Println(version.Full())
+	return exitOK
+}
 
-	if os.Args[1] == "url" {
-		mode = "url"
+func handleFirstArg(argument string) {
+	if f, ok := formats.Lookup(argument); ok {
+		mode = f.Name
 	}
+}
 
-	if os.Args[1] == "b" || os.Args[1] == "bbcode" {
-		mode = "bbcode"
-	}
+// setup loads the config and readies the database
+func setup() (err error) {
+	return setupWith(gifkv.Init)
 }
 
-func init() {
-	var err error
-	if len(os.Args) >= 2 {
-		handleFirstArg(os.Args[1])
-	}
+// setupReadOnly loads the config without initializing the database, for subcommands
+// that only read it and can run while another process is writing
+func setupReadOnly() (err error) {
+	return setupWith(func() (bool, error) { return true, nil })
+}
 
+// setupWith loads the config and readies the database using the initializer
+func setupWith(initialize func() (bool, error)) (err error) {
 	dropboxClient, err = dropbox.DefaultClient()
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return
 	}
 
+	err = registerTemplates(dropboxClient.Config.OutputTemplates())
+	if err != nil {
+		return
+	}
+
+	_, err = gifkv.SetStorage(dropboxClient.Config.Storage())
+	if err != nil {
+		return
+	}
 	gifkv.SetDatabasePath(dropboxClient.Config.DatabasePath())
-	_, err = gifkv.Init()
+	gifkv.SetHTTPClient(dropboxClient.HTTP)
+	dropbox.SetPassphrasePrompt(promptPassphrase)
+	if dropboxClient.Config.SyncEnabled() {
+		_, err = gifkv.SetSync(gifkv.SyncConfig{
+			Dir:     dropboxClient.Config.SyncDir(),
+			Machine: dropboxClient.Config.MachineName(),
+			Shared:  dropboxClient.Config.SharedDatabasePath(),
+			State:   dropboxClient.Config.SyncStatePath(),
+		})
+		if err != nil {
+			return
+		}
+	} else {
+		gifkv.StopSync()
+	}
+	_, err = initialize()
+	if errors.Is(err, gifkv.ErrLocked) {
+		return
+	}
 	if err != nil {
-		fmt.Printf("Error initiating database: %v (%v)\n", err.Error(), dropboxClient.Config.DatabasePath())
-		os.Exit(1)
+		err = fmt.Errorf("Error initiating database: %v (%v)", err.Error(), dropboxClient.Config.DatabasePath())
 	}
+	return
+}
 
-	clear.Clear()
-	fmt.Println(messages.Welcome(version.Current()))
+// templateNames are the user-defined templates registered, so a profile switch
+// can replace them
+var templateNames []string
+
+// registerTemplates makes each user-defined template a selectable mode, in place
+// of any registered before
+func registerTemplates(templates map[string]string) (err error) {
+	for _, name := range templateNames {
+		formats.Unregister(name)
+	}
+	templateNames = nil
+	var names []string
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if commands.Any(name) {
+			return fmt.Errorf("the %v template conflicts with an existing command", name)
+		}
+		err = formats.RegisterTemplate(name, templates[name])
+		if err != nil {
+			return
+		}
+		templateNames = append(templateNames, name)
+	}
+	return
 }
 
 func convert(link dropbox.Link, checksum string) (newGif gifkv.Record, err error) {
@@ -93,57 +183,283 @@ func convert(link dropbox.Link, checksum string) (newGif gifkv.Record, err error
 	return
 }
 
-func capture(gifRecord gifkv.Record) {
-	if gifRecord != (gifkv.Record{}) {
+func capture(gifRecord *gifkv.Record) {
+	if *gifRecord != (gifkv.Record{}) {
+		copied(gifRecord)
 		fmt.Println(messages.LinkTextNew(gifRecord.String()))
-		if md() {
-			fmt.Println(messages.LinkTextNew(gifRecord.Markdown()))
-			clipboard.Write(gifRecord.Markdown())
-		} else if bbcode() {
-			fmt.Println(messages.LinkTextNew(gifRecord.BBCode()))
-			clipboard.Write(gifRecord.BBCode())
-		} else {
-			fmt.Println(messages.LinkTextNew(gifRecord.URL()))
-			clipboard.Write(gifRecord.URL())
+		output, err := format(*gifRecord)
+		if err != nil {
+			fmt.Println(messages.Error("Unable to format the link", err))
+			return
+		}
+		fmt.Println(messages.LinkTextNew(output))
+		clipboard.Write(output)
+		fmt.Println("")
+	}
+}
+
+// captureAll copies the links for every record to the clipboard as one block
+func captureAll(gifRecords []gifkv.Record) {
+	if len(gifRecords) == 1 {
+		capture(&gifRecords[0])
+		return
+	}
+	var links []string
+	for i := range gifRecords {
+		copied(&gifRecords[i])
+		fmt.Println(messages.LinkTextNew(gifRecords[i].String()))
+		output, err := format(gifRecords[i])
+		if err != nil {
+			fmt.Println(messages.Error("Unable to format the link", err))
+			continue
 		}
+		fmt.Println(messages.LinkTextNew(output))
+		links = append(links, output)
+	}
+	if len(links) > 0 {
+		clipboard.Write(strings.Join(links, "\n"))
+		fmt.Println(messages.Info(fmt.Sprintf("%d links copied to clipboard", len(links))))
 		fmt.Println("")
 	}
 }
 
+// copied tracks the use of the record, for the recent and top lists
+func copied(gifRecord *gifkv.Record) {
+	if !gifRecord.Persisted() {
+		return
+	}
+	_, err := gifRecord.Copied()
+	if err != nil {
+		fmt.Println(messages.Error("Unable to track usage", err))
+	}
+}
+
+// format returns the record formatted for the current mode
+func format(gifRecord gifkv.Record) (string, error) {
+	f, _ := formats.Lookup(mode)
+	return f.Output(gifRecord)
+}
+
+// link returns the record for the gif, verifying any cached record is still
+// good remotely and creating a new Dropbox link when needed. Requests to Dropbox
+// are given up on when the context is done.
+func link(ctx context.Context, cleaned string, out io.Writer) (gifRecord gifkv.Record, err error) {
+	var remoteOK bool
+	var dropboxLink dropbox.Link
+
+	// if the file pre-exists, load it and validate the remote status
+	md5checksum, err := handler.MD5Checksum(cleaned)
+	if err == nil {
+		gifRecord, err = gifkv.Find(md5checksum)
+		if err == nil {
+			// validate it is still good
+			remoteOK, err = gifRecord.RemoteOKContext(ctx)
+			if err != nil {
+				err = stepError{"Error verifying remote status", err}
+				return
+			}
+			if remoteOK {
+				fmt.Fprintln(out, messages.Happy("Remote 200 OK."))
+				if gifRecord.Width == 0 {
+					// backfill the dimensions of records cached before they were tracked
+					measure(&gifRecord, cleaned)
+					// the link is still good without them, so it's used either way
+					if _, saveErr := gifRecord.Save(); saveErr != nil {
+						fmt.Fprintln(out, messages.Error("Unable to save the gif's dimensions", saveErr))
+					}
+				}
+				return
+			}
+			// if not, delete it, and move on
+			fmt.Fprintln(out, messages.Sad("Remote not 200 OK. Updating cache."))
+			_, err = gifRecord.Delete()
+			if err != nil {
+				err = stepError{"Unable to delete", err}
+				return
+			}
+		}
+	}
+
+	// create the actual public link via dropbox
+	dropboxLink, err = dropboxClient.CreateLinkContext(ctx, cleaned)
+	if err != nil {
+		err = stepError{"Error creating link", err}
+		return
+	}
+	// use the link and the checksum to create a gifRecord
+	gifRecord, err = convert(dropboxLink, md5checksum)
+	if err != nil {
+		err = stepError{"Error converting link", err}
+		return
+	}
+	measure(&gifRecord, cleaned)
+	// save the gifRecord
+	_, err = gifRecord.Save()
+	if err != nil {
+		err = stepError{"Error saving gif", err}
+	}
+	return
+}
+
+// measure sets the dimensions of the record, when they can be read
+func measure(gifRecord *gifkv.Record, cleaned string) {
+	width, height, err := handler.Dimensions(cleaned)
+	if err == nil {
+		gifRecord.Width = width
+		gifRecord.Height = height
+	}
+}
+
+// failure returns the properly formatted message for a linking error, with
+// what to do about it when that's known
+func failure(err error) string {
+	message := messages.Error("Error handling input", err)
+	if e, ok := err.(stepError); ok {
+		message = messages.Error(e.step, e.err)
+	}
+	if tip := advice(err); tip != "" {
+		message += "\n" + messages.Info(tip)
+	}
+	return message
+}
+
+// advice returns what to do about an error from Dropbox, or nothing when
+// there's nothing to suggest
+func advice(err error) string {
+	switch {
+	case errors.Is(err, dropbox.ErrNotLoggedIn):
+		return "Use auth to log in with Dropbox"
+	case errors.Is(err, dropbox.ErrTokenExpired):
+		return "Your Dropbox token has expired. Use auth to log in again"
+	case errors.Is(err, dropbox.ErrInvalidToken):
+		return "Dropbox doesn't recognize your token. Use auth to log in again"
+	case errors.Is(err, dropbox.ErrWrongPassphrase):
+		return "Check your passphrase, or use encrypt-token to encrypt your token again"
+	case errors.Is(err, dropbox.ErrEmailNotVerified):
+		return "Dropbox won't share links until you verify your email address"
+	case errors.Is(err, dropbox.ErrNotFound):
+		return "Dropbox can't find that gif. Wait for it to finish syncing, then try again"
+	case errors.Is(err, dropbox.ErrLinkExists):
+		return "Dropbox already has a link for that gif. Try again to use it"
+	case errors.Is(err, dropbox.ErrRateLimited):
+		return "Dropbox needs a break. Wait a minute, then try again"
+	}
+	return ""
+}
+
+// readLines sends each line read from the reader, closing when input ends
+func readLines(reader *bufio.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return lines
+}
+
+// readInput waits for a line, then gathers any lines pasted along with it
+func readInput(lines <-chan string) (input []string, ok bool) {
+	line, ok := <-lines
+	for ok {
+		input = append(input, line)
+		select {
+		case line, ok = <-lines:
+			if !ok {
+				return input, true
+			}
+		case <-time.After(pasteDelay):
+			return
+		}
+	}
+	return
+}
+
+// group joins consecutive pasted paths into one input, keeping commands separate
+func group(lines []string) (inputs []string) {
+	var paths []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if _, pick := commands.Pick(line); commands.Any(line) || pick {
+			if len(paths) > 0 {
+				inputs = append(inputs, strings.Join(paths, "\n"))
+				paths = nil
+			}
+			inputs = append(inputs, line)
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if len(paths) > 0 {
+		inputs = append(inputs, strings.Join(paths, "\n"))
+	}
+	return
+}
+
 func configMessage() string {
 	config := "Current Config:\n"
 	config += fmt.Sprintf("- Path:      %v\n", dropboxClient.Config.LoadedPath())
 	config += fmt.Sprintf("- Gifs Path: %v\n", dropboxClient.Config.FullPath())
 	config += fmt.Sprintf("- Db Path:   %v\n", dropboxClient.Config.DatabasePath())
 	config += fmt.Sprintf("- Db Gifs:   %v\n", humanize.Comma(int64(gifkv.Count())))
-	config += fmt.Sprintf("- Token:     %v", dropboxClient.Config.Token())
+	config += fmt.Sprintf("- Env:       %v\n", dropboxClient.Config.Environment())
+	if name := dropboxClient.Config.Profile(); name != "" {
+		config += fmt.Sprintf("- Profile:   %v\n", name)
+	}
+	if dropboxClient.LoggedIn() {
+		config += fmt.Sprintf("- Login:     %v", dropboxClient.Config.CredentialsPath())
+	} else {
+		config += fmt.Sprintf("- Token:     %v", dropboxClient.TokenSource())
+	}
 	return config
 }
 
 func helpMessage() string {
-	return fmt.Sprintf("Usage: Drag and drop a single gif at a time.\n\n%v", commands.HelpOutput())
+	return fmt.Sprintf("Usage: Drag and drop one or more gifs, or a directory of gifs.\n\n%v", commands.HelpOutput())
 }
 
-func handleCommand(input string, gifRecord gifkv.Record) bool {
+func handleCommand(ctx context.Context, input string) bool {
 	if commands.Exit(input) {
 		fmt.Println(messages.Goodbye())
 		return false
-	} else if commands.URLMode(input) {
-		mode = "url"
-		fmt.Println(messages.ModeShift("url"))
-		capture(gifRecord)
-	} else if commands.MarkdownMode(input) {
-		mode = "md"
-		fmt.Println(messages.ModeShift("md"))
-		capture(gifRecord)
-	} else if commands.BBCodeMode(input) {
-		mode = "bbcode"
-		fmt.Println(messages.ModeShift("bbcode"))
-		capture(gifRecord)
+	} else if f, ok := commands.Mode(input); ok {
+		mode = f.Name
+		fmt.Println(messages.ModeShift(mode))
+		captureAll(current)
+	} else if commands.Search(input) {
+		search(commands.Arguments(input))
+	} else if commands.Delete(input) {
+		purge(commands.Arguments(input))
+	} else if commands.Auth(input) {
+		auth(commands.Arguments(input))
+	} else if commands.Profile(input) {
+		profile(commands.Arguments(input))
+	} else if commands.Verify(input) {
+		verifyAll(ctx, commands.Arguments(input))
+	} else if commands.History(input) {
+		showHistory()
+	} else if commands.Back(input) {
+		back()
+	} else if commands.Recopy(input) {
+		recopy(commands.Arguments(input))
+	} else if commands.Recent(input) {
+		recent()
+	} else if commands.Top(input) {
+		top()
 	} else if commands.Help(input) {
 		fmt.Println(messages.Help(helpMessage()))
 	} else if commands.Config(input) {
-		fmt.Println(messages.Help(configMessage()))
+		fmt.Println(messages.Help(showConfig(commands.Arguments(input))))
 	} else if commands.Count(input) {
 		fmt.Println(messages.Help(humanize.Comma(int64(gifkv.Count())) + " total"))
 	} else if commands.Version(input) {
@@ -155,104 +471,116 @@ func handleCommand(input string, gifRecord gifkv.Record) bool {
 }
 
 func main() {
-	var link dropbox.Link
+	args, err := globalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	if len(args) >= 1 {
+		if subcommand, ok := subcommands[args[0]]; ok {
+			os.Exit(subcommand(args[1:]))
+		}
+	}
+
+	err = setup()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if len(args) >= 1 {
+		handleFirstArg(args[0])
+	}
+
+	// ask for any passphrase now, before the listener is reading input
+	unlockErr := dropboxClient.Unlock()
+
+	clear.Clear()
+	fmt.Println(messages.Welcome(version.Current()))
+	if unlockErr != nil {
+		fmt.Println(failure(stepError{"Unable to get your Dropbox token", unlockErr}))
+	}
+	if dropboxClient.Config.SyncEnabled() {
+		syncOnStartup()
+	}
+	listen()
+}
+
+// listen handles dropped gifs and commands until told to exit
+func listen() {
 	var gifRecord gifkv.Record
-	var input, cachedInput, cleaned, md5checksum, cachedChecksum string
+	var input string
+	var pending, paths, burst []string
 	var err error
-	var continueOn, remoteOK bool
+	var ok bool
+	// each input can be interrupted with Ctrl-C, which ends the program otherwise
+	var ctx context.Context
+	stop := func() {}
+	defer func() { stop() }()
 	defer gifkv.Disconnect()
-	reader := bufio.NewReader(os.Stdin)
-	handler := data.NewHandler()
+	lines := readLines(bufio.NewReader(os.Stdin))
+	listenerLines = lines
 	for {
-		gifkv.Disconnect() // make sure we're always disconnected while awaiting input
-		fmt.Println(messages.AwaitingInput(mode))
-		if input != "" {
-			cachedInput = input
-		}
-		input, _ = reader.ReadString('\n')
-		input = strings.Trim(strings.TrimSpace(input), "\"'")
-		gifkv.Connect()
-		if commands.Delete(input) && gifRecord.Persisted() {
-			fmt.Println(messages.Sad(fmt.Sprintf("Purging record: %v", gifRecord)))
-			_, err = gifRecord.Delete()
-			if err != nil {
-				fmt.Println(messages.Error("Unable to delete", err))
+		stop()
+		if len(pending) == 0 {
+			gifkv.Disconnect() // make sure we're always disconnected while awaiting input
+			fmt.Println(messages.AwaitingInput(mode, dropboxClient.Config.Profile()))
+			burst, ok = readInput(lines)
+			if !ok {
+				fmt.Println(messages.Goodbye())
+				break
+			}
+			pending = group(burst)
+			if len(pending) == 0 {
 				continue
 			}
-			clipboard.Write(cachedInput)
-			fmt.Println(messages.Info("Previous input copied to clipboard"))
-		} else if commands.Any(input) {
-			continueOn = handleCommand(input, gifRecord)
-			if !continueOn {
+			if _, err = gifkv.Connect(); err != nil {
+				fmt.Println(messages.Error("Error connecting to the database", err))
+				pending = nil
+				continue
+			}
+		}
+		input, pending = pending[0], pending[1:]
+		ctx, stop = interruptible()
+		if commands.Any(input) {
+			if !handleCommand(ctx, input) {
 				break
 			}
-		} else {
-			// cache the gifRecord checksum, then reset it
-			if gifRecord.Persisted() {
-				cachedChecksum = gifRecord.ID
+		} else if number, ok := commands.Pick(input); ok && len(results) > 0 {
+			if number > len(results) {
+				fmt.Println(messages.Sad(fmt.Sprintf("Pick a number from 1 to %d", len(results))))
+				continue
 			}
-			gifRecord = gifkv.Record{}
-
-			cleaned, err = handler.Clean(input)
+			current = results[number-1 : number]
+			captureAll(current)
+			session.Push(history.Entry{Record: current[0]})
+		} else {
+			paths, err = handler.Paths(input)
 			if err != nil {
 				fmt.Println(messages.Error("Error handling input", err))
 				continue
 			}
 
-			// if the file pre-exists, load it and validate the remote status
-			md5checksum, err = handler.MD5Checksum(cleaned)
-			if err == nil {
-				gifRecord, err = gifkv.Find(md5checksum)
-				if err == nil {
-					// validate it is still good
-					remoteOK, err = gifRecord.RemoteOK()
-					if err == nil {
-						if remoteOK {
-							fmt.Println(messages.Happy("Remote 200 OK."))
-							capture(gifRecord)
-							continue
-						} else {
-							// if not, delete it, and move on
-							fmt.Println(messages.Sad("Remote not 200 OK. Updating cache."))
-							_, err = gifRecord.Delete()
-							if err == nil {
-								gifRecord = gifkv.Record{}
-							} else {
-								fmt.Println(messages.Error("Unable to delete", err))
-								continue
-							}
-						}
-					} else {
-						// error checking remote status
-						fmt.Println(messages.Error("Error verifying remote status", err))
-						continue
-					}
+			var linked []gifkv.Record
+			var entries []history.Entry
+			for _, path := range paths {
+				if ctx.Err() != nil {
+					fmt.Println(messages.Sad("Interrupted"))
+					break
 				}
+				gifRecord, err = link(ctx, path, os.Stdout)
+				if err != nil {
+					fmt.Println(failure(err))
+					continue
+				}
+				linked = append(linked, gifRecord)
+				entries = append(entries, history.Entry{Input: path, Record: gifRecord})
 			}
-
-			// create the actual public link via dropbox
-			link, err = dropboxClient.CreateLink(cleaned)
-			if err != nil {
-				gifRecord, _ = gifkv.Find(cachedChecksum)
-				fmt.Println(messages.Error("Error creating link", err))
-				continue
-			}
-			// use the link and the checksum to create a gifRecord
-			gifRecord, err = convert(link, md5checksum)
-			if err != nil {
-				gifRecord, _ = gifkv.Find(cachedChecksum)
-				fmt.Println(messages.Error("Error converting link", err))
-				continue
-			}
-			// save the gifRecord
-			_, err := gifRecord.Save()
-			if err != nil {
-				gifRecord, _ = gifkv.Find(cachedChecksum)
-				fmt.Println(messages.Error("Error saving gif", err))
-				continue
+			if len(linked) > 0 {
+				current = linked
+				captureAll(current)
+				session.Push(entries...)
 			}
-
-			capture(gifRecord)
 		}
 	}
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/library"
+)
+
+// indexCommand reports which local gifs are linked, and optionally links the rest
+func indexCommand(args []string) int {
+	flags := flag.NewFlagSet("index", flag.ContinueOnError)
+	createLinks := flags.Bool("link", false, "create links for the unlinked gifs")
+	workers := flags.Int("workers", runtime.NumCPU(), "the number of folders to read, and gifs to checksum, at once")
+	linkWorkers := flags.Int("link-workers", 4, "the number of links to create at once")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker index [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	// without creating links, the database is only read
+	connect, setupIndex := gifkv.ConnectReadOnly, setupReadOnly
+	if *createLinks {
+		connect, setupIndex = gifkv.Connect, setup
+	}
+	if err := setupIndex(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	if _, err := connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	root := dropboxClient.Config.FullPath()
+	fmt.Printf("Indexing %v...\n", root)
+	gifs, err := library.Scan(root, *workers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	var records []gifkv.Record
+	err = gifkv.Each(func(r gifkv.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	report := library.Compare(root, gifs, records)
+
+	fmt.Printf("Cached:   %d\n", len(report.Cached))
+	fmt.Printf("Unlinked: %d\n", len(report.Unlinked))
+	for _, gif := range report.Unlinked {
+		fmt.Printf("  %v\n", gif.Path)
+	}
+	fmt.Printf("Missing:  %d\n", len(report.Missing))
+	for _, r := range report.Missing {
+		fmt.Printf("  %v\n", library.LocalPath(root, r))
+	}
+	status := exitOK
+	if len(report.Failed) > 0 {
+		fmt.Printf("Failed:   %d\n", len(report.Failed))
+		for _, gif := range report.Failed {
+			fmt.Printf("  %v: %v\n", gif.Path, gif.Err)
+		}
+		status = exitFailure
+	}
+
+	if *createLinks && len(report.Unlinked) > 0 {
+		ctx, stop := interruptible()
+		defer stop()
+		fmt.Printf("Linking %d gifs...\n", len(report.Unlinked))
+		var mutex sync.Mutex
+		linked := 0
+		library.Each(len(report.Unlinked), *linkWorkers, func(i int) {
+			gif := report.Unlinked[i]
+			if ctx.Err() != nil {
+				return
+			}
+			_, err := link(ctx, gif.Path, ioutil.Discard)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", gif.Path, err)
+				status = exitFailure
+				return
+			}
+			linked++
+		})
+		fmt.Printf("Linked:   %d\n", linked)
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "interrupted")
+			status = exitFailure
+		}
+	}
+	return status
+}
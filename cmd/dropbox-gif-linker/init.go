@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/dropbox"
+)
+
+// initCommand walks through creating the config, checking each answer as it goes
+func initCommand(args []string) int {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	force := flags.Bool("force", false, "replace an existing config without asking")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker init [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	path := dropbox.DefaultConfigPath()
+	reader := bufio.NewReader(os.Stdin)
+
+	if _, err := os.Stat(path); err == nil && !*force {
+		answer, err := ask(reader, fmt.Sprintf("%v already exists. Replace it? [y/N]: ", path), "n")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		if !yes(answer) {
+			fmt.Printf("Left %v as it was\n", path)
+			return exitOK
+		}
+	}
+
+	config := dropbox.Config{Loaded: true}
+	var err error
+	if config.DropboxPath, err = askDropboxPath(reader); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if config.GifDir, err = askGifDir(reader, config.DropboxPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err = askCredentials(reader, &config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if err = config.Save(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Printf("Config saved to %v\n", path)
+	if config.APIToken != "" {
+		fmt.Println("Run dropbox-gif-linker to start linking, or encrypt-token to keep the token out of the config")
+	} else {
+		fmt.Println("Run dropbox-gif-linker to start linking")
+	}
+	return exitOK
+}
+
+// askDropboxPath offers the Dropbox folders found on this machine, or takes any path
+func askDropboxPath(reader *bufio.Reader) (string, error) {
+	folders := dropbox.DetectFolders()
+	fallback := "~/Dropbox"
+	if len(folders) > 0 {
+		fmt.Println("Found these Dropbox folders:")
+		for i, folder := range folders {
+			fmt.Printf("%3d. %v\n", i+1, folder)
+		}
+		fallback = "1"
+	}
+	for {
+		answer, err := ask(reader, fmt.Sprintf("Dropbox folder (a number or a path) [%v]: ", fallback), fallback)
+		if err != nil {
+			return "", err
+		}
+		if number, err := strconv.Atoi(answer); err == nil {
+			if number < 1 || number > len(folders) {
+				fmt.Printf("Pick a number from 1 to %d\n", len(folders))
+				continue
+			}
+			answer = folders[number-1].Path
+		}
+		if !strings.HasPrefix(answer, "~/") && !strings.HasPrefix(answer, string(os.PathSeparator)) {
+			fmt.Println("Enter a path starting with ~/ or /")
+			continue
+		}
+		if !isDir(answer) {
+			fmt.Printf("There's no folder at %v\n", answer)
+			continue
+		}
+		return strings.TrimSuffix(answer, string(os.PathSeparator)), nil
+	}
+}
+
+// askGifDir offers the folders with gif in their names, or takes any folder in the Dropbox folder
+func askGifDir(reader *bufio.Reader, dropboxPath string) (string, error) {
+	fallback := "/gifs"
+	if dirs := dropbox.GifDirs(dropboxPath); len(dirs) > 0 {
+		fallback = dirs[0]
+		if len(dirs) > 1 {
+			fmt.Printf("Found these gif folders: %v\n", strings.Join(dirs, ", "))
+		}
+	}
+	for {
+		answer, err := ask(reader, fmt.Sprintf("Gif folder, inside %v [%v]: ", dropboxPath, fallback), fallback)
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(answer, string(os.PathSeparator)) {
+			answer = string(os.PathSeparator) + answer
+		}
+		answer = strings.TrimSuffix(answer, string(os.PathSeparator))
+		if !isDir(dropboxPath + answer) {
+			fmt.Printf("There's no folder at %v%v\n", dropboxPath, answer)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// askCredentials logs in with an app key, or takes a token, whichever is picked
+func askCredentials(reader *bufio.Reader, config *dropbox.Config) error {
+	fmt.Println("How should the linker get into your Dropbox?")
+	fmt.Println("  1. Log in with your app's App key, and stay logged in")
+	fmt.Println("  2. Paste an access token, which expires after a few hours")
+	for {
+		answer, err := ask(reader, "Pick one [1]: ", "1")
+		if err != nil {
+			return err
+		}
+		switch answer {
+		case "1":
+			config.App, err = askLogin(reader, *config)
+			return err
+		case "2":
+			config.APIToken, err = askToken(reader, *config)
+			return err
+		}
+		fmt.Println("Pick 1 or 2")
+	}
+}
+
+// askLogin takes an app key and logs in with it, saving the credentials so the
+// access token can be refreshed as it expires
+func askLogin(reader *bufio.Reader, config dropbox.Config) (string, error) {
+	fmt.Println("Copy the App key from your app at https://www.dropbox.com/developers/apps")
+	for {
+		prompt := "App key: "
+		if config.App != "" {
+			prompt = fmt.Sprintf("App key [%v]: ", config.App)
+		}
+		key, err := ask(reader, prompt, config.App)
+		if err != nil {
+			return "", err
+		}
+		if config.App = key; key == "" {
+			continue
+		}
+		client := dropbox.NewClient(config)
+		login, err := client.NewLogin()
+		if err != nil {
+			fmt.Printf("Unable to log in: %v\n", err)
+			continue
+		}
+		fmt.Printf("Go to %v\n", login.URL())
+		code, err := ask(reader, "Click Allow, then enter the code Dropbox shows you: ", "")
+		if err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err = client.Login(ctx, login, code); err != nil {
+			cancel()
+			fmt.Printf("Unable to log in: %v\n", err)
+			continue
+		}
+		account, err := client.CurrentAccount(ctx)
+		cancel()
+		if err == nil {
+			fmt.Printf("Logged in as %v\n", account)
+		} else {
+			// the credentials are saved already, so the login still counts
+			fmt.Printf("Logged in, but unable to check the account: %v\n", err)
+		}
+		fmt.Printf("Credentials saved to %v\n", config.CredentialsPath())
+		return key, nil
+	}
+}
+
+// askToken takes a token, checking that Dropbox accepts it before it's saved
+func askToken(reader *bufio.Reader, config dropbox.Config) (string, error) {
+	fmt.Println("Generate an access token in your app at https://www.dropbox.com/developers/apps")
+	for {
+		token, err := readSecret(reader, "Dropbox API token: ")
+		if err != nil {
+			return "", err
+		}
+		if token = strings.TrimSpace(token); token == "" {
+			continue
+		}
+		config.APIToken = token
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		account, err := dropbox.NewClient(config).CurrentAccount(ctx)
+		cancel()
+		if err == nil {
+			fmt.Printf("The token works for %v\n", account)
+			return token, nil
+		}
+		if errors.Is(err, dropbox.ErrInvalidToken) || errors.Is(err, dropbox.ErrTokenExpired) {
+			fmt.Printf("Dropbox didn't accept the token: %v\n", err)
+			continue
+		}
+		// the token may be fine, with Dropbox out of reach
+		fmt.Printf("Unable to check the token with Dropbox: %v\n", err)
+		answer, err := ask(reader, "Save it anyway? [y/N]: ", "n")
+		if err != nil {
+			return "", err
+		}
+		if yes(answer) {
+			return token, nil
+		}
+	}
+}
+
+// ask prompts for a line, returning the fallback when it's left empty
+func ask(reader *bufio.Reader, prompt string, fallback string) (string, error) {
+	fmt.Print(prompt)
+	answer, err := reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if err != nil && answer == "" {
+		return "", errors.New("\nsetup stopped before it was finished")
+	}
+	if answer == "" {
+		return fallback, nil
+	}
+	return answer, nil
+}
+
+func yes(answer string) bool {
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes"
+}
+
+func isDir(path string) bool {
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(expanded)
+	return err == nil && info.IsDir()
+}
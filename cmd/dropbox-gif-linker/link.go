@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/clipboard"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/formats"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+// exit statuses for subcommands
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	exitSetup   = 3
+)
+
+// linkCommand links each gif passed, printing the formatted links to stdout
+func linkCommand(args []string) int {
+	flags := flag.NewFlagSet("link", flag.ContinueOnError)
+	formatName := flags.String("format", "url", fmt.Sprintf("output format: %v, or a template name", strings.Join(formats.Names(), ", ")))
+	toClipboard := flags.Bool("clipboard", false, "also copy the links to the clipboard")
+	verbose := flags.Bool("verbose", false, "print progress details to stderr")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker link [flags] path/to/file.gif...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	if err := setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	f, ok := formats.Lookup(*formatName)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unsupported format [%v]\n", *formatName)
+		return exitUsage
+	}
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	var progress io.Writer = ioutil.Discard
+	if *verbose {
+		progress = os.Stderr
+	}
+
+	status := exitOK
+	var links []string
+	for _, arg := range flags.Args() {
+		paths, err := handler.Expand(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = exitFailure
+			continue
+		}
+		for _, path := range paths {
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "interrupted")
+				return exitFailure
+			}
+			gifRecord, err := link(ctx, path, progress)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", path, err)
+				if tip := advice(err); tip != "" {
+					fmt.Fprintln(os.Stderr, tip)
+				}
+				status = exitFailure
+				continue
+			}
+			if _, err = gifRecord.Copied(); err != nil {
+				fmt.Fprintf(os.Stderr, "%v: unable to track usage: %v\n", path, err)
+			}
+			output, err := f.Output(gifRecord)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", path, err)
+				status = exitFailure
+				continue
+			}
+			fmt.Println(output)
+			links = append(links, output)
+		}
+	}
+
+	if *toClipboard && len(links) > 0 {
+		clipboard.Write(strings.Join(links, "\n"))
+	}
+	return status
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/dropbox"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/formats"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/history"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/messages"
+)
+
+// profile lists the profiles from the listener, or switches to the named one
+func profile(name string) {
+	if name == "" {
+		fmt.Println(messages.Help(profilesMessage(dropboxClient.Config.ProfileNames(), dropboxClient.Config.Profile())))
+		return
+	}
+	if name == dropboxClient.Config.Profile() || (name == dropbox.DefaultProfile && dropboxClient.Config.Profile() == "") {
+		fmt.Println(messages.Info(fmt.Sprintf("Already using the %v profile", name)))
+		return
+	}
+	if err := switchProfile(name); err != nil {
+		fmt.Println(messages.Error(fmt.Sprintf("Unable to switch to the %v profile", name), err))
+		return
+	}
+	fmt.Println(messages.Happy(fmt.Sprintf("Switched to the %v profile", name)))
+	if err := dropboxClient.Unlock(); err != nil {
+		fmt.Println(failure(stepError{"Unable to get your Dropbox token", err}))
+	}
+	if dropboxClient.Config.SyncEnabled() {
+		syncOnStartup()
+	}
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Println(messages.Error("Error connecting to the database", err))
+	}
+}
+
+// profilesMessage lists the profiles, marking the one in use
+func profilesMessage(names []string, active string) string {
+	if len(names) == 0 {
+		return "There are no profiles in the config"
+	}
+	if active == "" {
+		active = dropbox.DefaultProfile
+	}
+	message := "Profiles:"
+	for _, name := range append([]string{dropbox.DefaultProfile}, names...) {
+		marker := " "
+		if name == active {
+			marker = "*"
+		}
+		message += fmt.Sprintf("\n%v %v", marker, name)
+	}
+	return message
+}
+
+// switchProfile loads the named profile's config, database, and templates in place
+// of the current ones, which are kept when the profile can't be loaded. The
+// database is left disconnected when the switch works.
+func switchProfile(name string) (err error) {
+	previous := dropboxClient.Config.Profile()
+	if previous == "" {
+		previous = dropbox.DefaultProfile
+	}
+	dropbox.SetProfile(name)
+	if _, err = dropbox.NewConfig(); err != nil {
+		dropbox.SetProfile(previous)
+		return
+	}
+
+	gifkv.Disconnect()
+	if err = setup(); err != nil {
+		dropbox.SetProfile(previous)
+		if restoreErr := setup(); restoreErr != nil {
+			err = fmt.Errorf("%v, then the %v profile failed too: %v", err, previous, restoreErr)
+		}
+		gifkv.Connect()
+		return
+	}
+	if _, ok := formats.Lookup(mode); !ok {
+		mode = "url"
+	}
+	session = history.New(historyLimit)
+	results, current = nil, nil
+	pendingLogin = nil
+	return
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/clipboard"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/commands"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/formats"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/messages"
+)
+
+// maxResults caps how many records are listed at once
+var maxResults = 20
+
+// search lists the records matching the terms, ready to be picked by number
+func search(terms string) {
+	found, err := gifkv.Search(terms)
+	if err != nil {
+		fmt.Println(messages.Error("Unable to search", err))
+		return
+	}
+	if len(found) == 0 {
+		fmt.Println(messages.Sad(fmt.Sprintf("No gifs match \"%v\"", terms)))
+		return
+	}
+	list(found)
+}
+
+// recent lists the most recently copied records, ready to be picked by number
+func recent() {
+	found, err := gifkv.Recent(maxResults)
+	if err != nil {
+		fmt.Println(messages.Error("Unable to load recent gifs", err))
+		return
+	}
+	if len(found) == 0 {
+		fmt.Println(messages.Sad("No gifs have been copied yet"))
+		return
+	}
+	list(found)
+}
+
+// top lists the most frequently copied records, ready to be picked by number
+func top() {
+	found, err := gifkv.Top(maxResults)
+	if err != nil {
+		fmt.Println(messages.Error("Unable to load top gifs", err))
+		return
+	}
+	if len(found) == 0 {
+		fmt.Println(messages.Sad("No gifs have been copied yet"))
+		return
+	}
+	list(found)
+}
+
+// list prints the records as a numbered list and remembers them for picking
+func list(records []gifkv.Record) {
+	if len(records) > maxResults {
+		records = records[:maxResults]
+	}
+	results = records
+	fmt.Println(messages.LinkTextOld(numbered(records)))
+	fmt.Println(messages.Info("Enter a number to copy its link"))
+}
+
+// numbered returns the records as a numbered list
+func numbered(records []gifkv.Record) string {
+	var lines []string
+	for i, r := range records {
+		line := fmt.Sprintf("%3d. %v", i+1, r)
+		if r.Count > 0 {
+			line += fmt.Sprintf(" - %v", r.Usage())
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// searchCommand lists the matching records, then copies the picked link
+func searchCommand(args []string) int {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	formatName := flags.String("format", "url", fmt.Sprintf("output format: %v, or a template name", strings.Join(formats.Names(), ", ")))
+	pick := flags.Int("pick", 0, "the result number to copy, instead of prompting for one")
+	limit := flags.Int("limit", maxResults, "the maximum number of results to list")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker search [flags] terms...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	if err := setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	f, ok := formats.Lookup(*formatName)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unsupported format [%v]\n", *formatName)
+		return exitUsage
+	}
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	found, err := gifkv.Search(strings.Join(flags.Args(), " "))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if len(found) == 0 {
+		fmt.Fprintln(os.Stderr, "no gifs found")
+		return exitFailure
+	}
+	if *limit > 0 && len(found) > *limit {
+		found = found[:*limit]
+	}
+
+	number := *pick
+	if number == 0 {
+		fmt.Println(numbered(found))
+		if !interactive() {
+			return exitOK
+		}
+		fmt.Fprint(os.Stderr, "Pick a number to copy its link (or press enter to skip): ")
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(input) == "" {
+			return exitOK
+		}
+		if number, ok = commands.Pick(input); !ok {
+			fmt.Fprintf(os.Stderr, "not a number [%v]\n", strings.TrimSpace(input))
+			return exitUsage
+		}
+	}
+	if number < 1 || number > len(found) {
+		fmt.Fprintf(os.Stderr, "pick a number from 1 to %d\n", len(found))
+		return exitUsage
+	}
+
+	picked := found[number-1]
+	output, err := f.Output(picked)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Println(output)
+	clipboard.Write(output)
+	if _, err = picked.Copied(); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to track usage: %v\n", err)
+	}
+	return exitOK
+}
+
+// interactive returns whether stdin is a terminal
+func interactive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/clipboard"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/commands"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/history"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/messages"
+)
+
+// historyLimit caps how many records the session history holds
+var historyLimit = 50
+
+// showHistory lists the records processed this session, most recent first
+func showHistory() {
+	if session.Len() == 0 {
+		fmt.Println(messages.Sad("No gifs processed yet"))
+		return
+	}
+	var lines []string
+	for i, e := range session.Entries() {
+		lines = append(lines, fmt.Sprintf("%3d. %v", i+1, e.Record))
+	}
+	fmt.Println(messages.LinkTextOld(strings.Join(lines, "\n")))
+	fmt.Println(messages.Info("Use recopy N or delete N to work with a gif"))
+}
+
+// back drops the most recent gif from the history and copies the one before it
+func back() {
+	e, err := session.Back()
+	if err != nil {
+		fmt.Println(messages.Error("Unable to go back", err))
+		return
+	}
+	restore(e)
+}
+
+// recopy copies the numbered gif from the history
+func recopy(argument string) {
+	number, ok := commands.Pick(argument)
+	if !ok {
+		fmt.Println(messages.Sad("Which one? Use recopy N, with N from history"))
+		return
+	}
+	e, err := session.Get(number)
+	if err != nil {
+		fmt.Println(messages.Error("Unable to recopy", err))
+		return
+	}
+	restore(e)
+}
+
+// restore makes the entry current and copies it, using the latest saved record
+func restore(e history.Entry) {
+	if found, err := gifkv.Find(e.Record.ID); err == nil {
+		e.Record = found
+	}
+	current = []gifkv.Record{e.Record}
+	captureAll(current)
+}
+
+// purge deletes the numbered gif from the history, or the last gifs copied,
+// then copies their original input to the clipboard so they can be relinked
+func purge(argument string) {
+	var gifRecords []gifkv.Record
+	var inputs []string
+	if argument == "" {
+		gifRecords = current
+		for _, gifRecord := range current {
+			if e, err := session.Get(position(gifRecord)); err == nil && e.Input != "" {
+				inputs = append(inputs, e.Input)
+			}
+		}
+	} else {
+		number, ok := commands.Pick(argument)
+		if !ok {
+			fmt.Println(messages.Sad("Which one? Use delete N, with N from history"))
+			return
+		}
+		e, err := session.Get(number)
+		if err != nil {
+			fmt.Println(messages.Error("Unable to delete", err))
+			return
+		}
+		gifRecords = []gifkv.Record{e.Record}
+		if e.Input != "" {
+			inputs = append(inputs, e.Input)
+		}
+	}
+	if len(gifRecords) == 0 {
+		return
+	}
+
+	for i := range gifRecords {
+		fmt.Println(messages.Sad(fmt.Sprintf("Purging record: %v", gifRecords[i])))
+		_, err := gifRecords[i].Delete()
+		if err != nil {
+			fmt.Println(messages.Error("Unable to delete", err))
+			return
+		}
+		session.RemoveRecord(gifRecords[i].ID)
+		forget(gifRecords[i].ID)
+	}
+	if len(inputs) > 0 {
+		clipboard.Write(strings.Join(inputs, "\n"))
+		fmt.Println(messages.Info("Previous input copied to clipboard"))
+	}
+}
+
+// position returns the history number of the record, or 0 when it isn't there
+func position(gifRecord gifkv.Record) int {
+	for i, e := range session.Entries() {
+		if e.Record.ID == gifRecord.ID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// forget drops a deleted record from the current and listed records
+func forget(checksum string) {
+	var kept []gifkv.Record
+	for _, gifRecord := range current {
+		if gifRecord.ID != checksum {
+			kept = append(kept, gifRecord)
+		}
+	}
+	current = kept
+	kept = nil
+	for _, gifRecord := range results {
+		if gifRecord.ID != checksum {
+			kept = append(kept, gifRecord)
+		}
+	}
+	results = kept
+}
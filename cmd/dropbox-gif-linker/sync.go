@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/messages"
+)
+
+// syncCommand applies the changes made on other machines, and merges any
+// conflicted copies of the shared database
+func syncCommand(args []string) int {
+	if err := setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	if !dropboxClient.Config.SyncEnabled() {
+		fmt.Fprintln(os.Stderr, "Syncing is turned off. Set \"sync\" to true in your config to turn it on.")
+		return exitUsage
+	}
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	report, err := gifkv.Sync()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Println(report)
+	return exitOK
+}
+
+// syncOnStartup catches the listener up with the other machines before it
+// starts, reporting anything it did
+func syncOnStartup() {
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Println(messages.Error("Error syncing", err))
+		return
+	}
+	defer gifkv.Disconnect()
+	report, err := gifkv.Sync()
+	if err != nil {
+		fmt.Println(messages.Error("Error syncing", err))
+		return
+	}
+	if report.Seeded > 0 || report.Applied > 0 || len(report.Merged) > 0 {
+		fmt.Println(messages.Info(report.String()))
+	}
+}
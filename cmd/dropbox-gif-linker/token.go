@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/dropbox"
+)
+
+// encryptTokenCommand encrypts the API token with a passphrase, so it no longer
+// has to sit in the config in plain text
+func encryptTokenCommand(args []string) int {
+	flags := flag.NewFlagSet("encrypt-token", flag.ContinueOnError)
+	out := flags.String("out", "", "where to write the encrypted token (default the token_file, or ~/.dgl/token.enc)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker encrypt-token [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	config, err := dropbox.NewConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	path := *out
+	if path == "" {
+		path = config.TokenFilePath()
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	token := config.APIToken
+	if token == "" {
+		if token, err = readSecret(reader, "Dropbox API token: "); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+	passphrase, err := readSecret(reader, "Passphrase: ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	again, err := readSecret(reader, "Passphrase (again): ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if passphrase != again {
+		fmt.Fprintln(os.Stderr, "the passphrases don't match")
+		return exitUsage
+	}
+	if err = dropbox.EncryptToken(path, token, passphrase); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Printf("Encrypted token saved to %v\n", path)
+	fmt.Printf("Set \"token_file\" to it in %v", config.LoadedPath())
+	if config.APIToken != "" {
+		fmt.Print(", and remove the \"dropbox_api_token\"")
+	}
+	fmt.Println()
+	return exitOK
+}
+
+// listenerLines are the lines the listener reads, once it has started, so a
+// passphrase asked for then is read from them instead of stdin
+var listenerLines <-chan string
+
+// promptPassphrase asks for the passphrase to the encrypted token file, reading
+// no further than its line, so the rest of stdin is left for the listener
+func promptPassphrase(path string) (string, error) {
+	prompt := fmt.Sprintf("Passphrase for %v: ", path)
+	if listenerLines != nil {
+		return secretLine(prompt, func() (string, error) {
+			line, ok := <-listenerLines
+			if !ok {
+				return "", io.EOF
+			}
+			return line, nil
+		})
+	}
+	return readSecret(bufio.NewReaderSize(byteReader{os.Stdin}, 16), prompt)
+}
+
+// byteReader reads a byte at a time
+type byteReader struct {
+	r io.Reader
+}
+
+func (b byteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return b.r.Read(p)
+}
+
+// readSecret asks for a line, without echoing it when stdin is a terminal
+func readSecret(reader *bufio.Reader, prompt string) (string, error) {
+	return secretLine(prompt, func() (string, error) { return reader.ReadString('\n') })
+}
+
+// secretLine asks for the line that read returns, without echoing it when stdin is a terminal
+func secretLine(prompt string, read func() (string, error)) (secret string, err error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if interactive() && stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	secret, err = read()
+	secret = strings.TrimRight(secret, "\r\n")
+	if err != nil && secret == "" {
+		return "", fmt.Errorf("nothing entered for %v", strings.TrimSuffix(strings.ToLower(prompt), ": "))
+	}
+	return secret, nil
+}
+
+// stty changes the terminal's settings, where there is stty to do so
+func stty(setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
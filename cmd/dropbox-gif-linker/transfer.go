@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/legacy"
+)
+
+// legacyFormat reads a pre-1.1.0 SQLite database
+const legacyFormat = "sqlite"
+
+// exportCommand writes the link database to stdout or a file
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", gifkv.JSONLines, "output format: jsonl or csv")
+	output := flags.String("output", "", "file to write to (default stdout)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker export [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if err := setupReadOnly(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	if _, err := gifkv.ConnectReadOnly(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		defer file.Close()
+		w = file
+	}
+	count, err := gifkv.Export(w, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if *output != "" {
+		fmt.Printf("Exported %d records to %v\n", count, *output)
+	}
+	return exitOK
+}
+
+// importCommand loads records from a file (or stdin, as "-") into the link database
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "input format: jsonl, csv, or sqlite for a pre-1.1.0 database (default based on the file extension)")
+	policy := flags.String("policy", string(gifkv.Merge), "what to do with existing records: merge, overwrite or skip")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker import [flags] <file|->")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = gifkv.CSV
+		case ".db", ".sqlite", ".sqlite3":
+			*format = legacyFormat
+		default:
+			*format = gifkv.JSONLines
+		}
+	}
+	if *format == legacyFormat {
+		return importLegacy(path, gifkv.ImportPolicy(*policy))
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		defer file.Close()
+		r = file
+	}
+
+	if err := setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	report, err := gifkv.Import(r, *format, gifkv.ImportPolicy(*policy))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Println(report)
+	return exitOK
+}
+
+// importLegacy loads the gifs and shared links from a pre-1.1.0 SQLite database,
+// listing any rows that were skipped or conflicted
+func importLegacy(path string, policy gifkv.ImportPolicy) int {
+	if path == "-" {
+		fmt.Fprintln(os.Stderr, "sqlite databases cannot be read from stdin")
+		return exitUsage
+	}
+	legacyReport, err := legacy.Read(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", path, err)
+		return exitFailure
+	}
+	for _, problem := range legacyReport.Skipped {
+		fmt.Printf("Skipped %v\n", problem)
+	}
+	for _, problem := range legacyReport.Conflicts {
+		fmt.Printf("Conflict %v\n", problem)
+	}
+
+	if err := setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	if _, err := gifkv.Connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	report, err := gifkv.ImportRecords(legacyReport.Records, policy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	fmt.Println(report)
+	return exitOK
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/library"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/messages"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/verify"
+)
+
+// What to do with the records whose links are gone
+const (
+	purgeDead  = "purge"
+	relinkDead = "relink"
+)
+
+// verifyWorkers is how many links the listener checks at once
+const verifyWorkers = 8
+
+// verifyCommand checks every cached link, optionally purging or relinking the dead ones
+func verifyCommand(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	workers := flags.Int("workers", verifyWorkers, "the number of links to check at once")
+	purge := flags.Bool("purge", false, "delete the records whose links are gone")
+	relink := flags.Bool("relink", false, "create new links for the records whose links are gone")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dropbox-gif-linker verify [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *purge && *relink {
+		fmt.Fprintln(os.Stderr, "use either --purge or --relink, not both")
+		return exitUsage
+	}
+	var action string
+	if *purge {
+		action = purgeDead
+	} else if *relink {
+		action = relinkDead
+	}
+
+	// without fixing anything, the database is only read
+	connect, setupVerify := gifkv.ConnectReadOnly, setupReadOnly
+	if action != "" {
+		connect, setupVerify = gifkv.Connect, setup
+	}
+	if err := setupVerify(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	if _, err := connect(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitSetup
+	}
+	defer gifkv.Disconnect()
+
+	records, err := allRecords()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	ctx, stop := interruptible()
+	defer stop()
+	fmt.Printf("Verifying %d links...\n", len(records))
+	summary := verify.Summarize(verify.RunContext(ctx, dropboxClient.HTTP, records, *workers))
+	fmt.Println(summary)
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "interrupted")
+		return exitFailure
+	}
+
+	unresolved := len(records) - len(summary[verify.OK])
+	if action != "" && len(summary[verify.Gone]) > 0 {
+		fixed := fixDead(ctx, summary.Dead(), action, func(r gifkv.Record, err error) {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", r.BaseName, err)
+		})
+		fmt.Printf("%-15v%d\n", fixedLabel(action), len(fixed))
+		unresolved -= len(fixed)
+	}
+	if unresolved > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// verifyAll checks every cached link from the listener, optionally purging or
+// relinking the dead ones, until the context is done
+func verifyAll(ctx context.Context, action string) {
+	if action != "" && action != purgeDead && action != relinkDead {
+		fmt.Println(messages.Sad("Use verify, verify purge, or verify relink"))
+		return
+	}
+	records, err := allRecords()
+	if err != nil {
+		fmt.Println(messages.Error("Unable to verify", err))
+		return
+	}
+	fmt.Println(messages.Info(fmt.Sprintf("Verifying %d links...", len(records))))
+	summary := verify.Summarize(verify.RunContext(ctx, dropboxClient.HTTP, records, verifyWorkers))
+	fmt.Println(messages.Help(summary.String()))
+	if ctx.Err() != nil {
+		fmt.Println(messages.Sad("Interrupted"))
+		return
+	}
+	if len(summary[verify.Gone]) == 0 {
+		return
+	}
+	if action == "" {
+		fmt.Println(messages.Sad("Use verify purge or verify relink to fix the dead links"))
+		return
+	}
+	fixed := fixDead(ctx, summary.Dead(), action, func(r gifkv.Record, err error) {
+		fmt.Println(messages.Error(r.BaseName, err))
+	})
+	for _, r := range fixed {
+		if action == purgeDead {
+			session.RemoveRecord(r.ID)
+			forget(r.ID)
+		}
+	}
+	fmt.Println(messages.Happy(fmt.Sprintf("%v %d", fixedLabel(action), len(fixed))))
+}
+
+// allRecords loads every cached record
+func allRecords() (records []gifkv.Record, err error) {
+	err = gifkv.Each(func(r gifkv.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	return
+}
+
+// fixDead purges or relinks the records, returning the ones it fixed and
+// reporting the rest, until the context is done
+func fixDead(ctx context.Context, records []gifkv.Record, action string, report func(gifkv.Record, error)) (fixed []gifkv.Record) {
+	for i := range records {
+		if ctx.Err() != nil {
+			report(records[i], ctx.Err())
+			continue
+		}
+		var err error
+		if action == purgeDead {
+			_, err = records[i].Delete()
+		} else {
+			err = relinkRecord(ctx, &records[i])
+		}
+		if err != nil {
+			report(records[i], err)
+			continue
+		}
+		fixed = append(fixed, records[i])
+	}
+	return
+}
+
+// relinkRecord creates a new Dropbox link for the record's local gif, keeping
+// its usage and dimensions
+func relinkRecord(ctx context.Context, gifRecord *gifkv.Record) error {
+	path := library.LocalPath(dropboxClient.Config.FullPath(), *gifRecord)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("the gif is no longer at %v", path)
+	}
+	dropboxLink, err := dropboxClient.CreateLinkContext(ctx, path)
+	if err != nil {
+		return stepError{"Error creating link", err}
+	}
+	relinked, err := convert(dropboxLink, gifRecord.ID)
+	if err != nil {
+		return stepError{"Error converting link", err}
+	}
+	relinked.Width, relinked.Height = gifRecord.Width, gifRecord.Height
+	relinked.Count, relinked.CreatedAt, relinked.CopiedAt = gifRecord.Count, gifRecord.CreatedAt, gifRecord.CopiedAt
+	if _, err = relinked.Save(); err != nil {
+		return stepError{"Error saving gif", err}
+	}
+	*gifRecord = relinked
+	return nil
+}
+
+func fixedLabel(action string) string {
+	if action == purgeDead {
+		return "Purged:"
+	}
+	return "Relinked:"
+}
@@ -2,18 +2,27 @@ package commands
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/formats"
 )
 
 var exitCommands = [4]string{"exit", "e", "quit", "q"}
-var urlCommands = [2]string{"url", "u"}
-var markdownCommands = [2]string{"md", "m"}
-var bbcodeCommands = [2]string{"bbcode", "b"}
 var deleteCommands = [2]string{"delete", "del"}
 var configCommands = [2]string{"config", "details"}
 var countCommands = [2]string{"count", "gifs"}
 var helpCommands = [2]string{"help", "?"}
 var versionCommands = [2]string{"version", "v"}
+var searchCommands = [2]string{"search", "find"}
+var recentCommands = [2]string{"recent", "r"}
+var topCommands = [2]string{"top", "t"}
+var historyCommands = [2]string{"history", "hist"}
+var backCommands = [2]string{"back", "undo"}
+var recopyCommands = [2]string{"recopy", "rc"}
+var verifyCommands = [1]string{"verify"}
+var authCommands = [2]string{"auth", "login"}
+var profileCommands = [1]string{"profile"}
 var taylorCommands = [4]string{"taylor", "taylorswift", "taylor swift", "swiftie"}
 
 // Exit returns true if the input is an exit command
@@ -21,24 +30,29 @@ func Exit(input string) (exists bool) {
 	return supported(input, exitCommands[:])
 }
 
+// Mode returns the format when the input is a mode command
+func Mode(input string) (formats.Format, bool) {
+	return formats.Lookup(input)
+}
+
 // URLMode returns true if the input is a url mode command
 func URLMode(input string) (exists bool) {
-	return supported(input, urlCommands[:])
+	return isMode(input, "url")
 }
 
 // MarkdownMode returns true if the input is a markdown mode command
 func MarkdownMode(input string) bool {
-	return supported(input, markdownCommands[:])
+	return isMode(input, "md")
 }
 
 // BBCodeMode returns true if the input is a bbcode mode command
 func BBCodeMode(input string) bool {
-	return supported(input, bbcodeCommands[:])
+	return isMode(input, "bbcode")
 }
 
-// Delete returns true if the input is a delete command
+// Delete returns true if the input is a delete command, with or without a number
 func Delete(input string) (exists bool) {
-	return supported(input, deleteCommands[:])
+	return supported(command(input), deleteCommands[:])
 }
 
 // Help returns true if the input is a help command
@@ -46,9 +60,9 @@ func Help(input string) bool {
 	return supported(input, helpCommands[:])
 }
 
-// Config returns true if the input is a config command
+// Config returns true if the input is a config command, with or without --sources
 func Config(input string) bool {
-	return supported(input, configCommands[:])
+	return supported(command(input), configCommands[:])
 }
 
 // Count returns true if the input is a count command
@@ -61,6 +75,69 @@ func Version(input string) bool {
 	return supported(input, versionCommands[:])
 }
 
+// Search returns true if the input is a search command, with or without terms
+func Search(input string) bool {
+	return supported(command(input), searchCommands[:])
+}
+
+// Recent returns true if the input is a recent command
+func Recent(input string) bool {
+	return supported(input, recentCommands[:])
+}
+
+// Top returns true if the input is a top command
+func Top(input string) bool {
+	return supported(input, topCommands[:])
+}
+
+// History returns true if the input is a history command
+func History(input string) bool {
+	return supported(input, historyCommands[:])
+}
+
+// Back returns true if the input is a back command
+func Back(input string) bool {
+	return supported(input, backCommands[:])
+}
+
+// Recopy returns true if the input is a recopy command, with or without a number
+func Recopy(input string) bool {
+	return supported(command(input), recopyCommands[:])
+}
+
+// Verify returns true if the input is a verify command, with or without a fix
+func Verify(input string) bool {
+	return supported(command(input), verifyCommands[:])
+}
+
+// Auth returns true if the input is an auth command, with or without a code
+func Auth(input string) bool {
+	return supported(command(input), authCommands[:])
+}
+
+// Profile returns true if the input is a profile command, with or without a name
+func Profile(input string) bool {
+	return supported(command(input), profileCommands[:])
+}
+
+// Arguments returns everything in the input after the command itself
+func Arguments(input string) string {
+	fields := strings.SplitN(strings.TrimSpace(input), " ", 2)
+	if len(fields) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(fields[1])
+}
+
+// Pick returns the number when the input is a pick from a numbered list
+func Pick(input string) (number int, ok bool) {
+	number, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || number < 1 {
+		return 0, false
+	}
+	return number, true
+}
+
 // Taylor returns true if the input is a <3 Taylor Swift <3 command
 func Taylor(input string) bool {
 	return supported(input, taylorCommands[:])
@@ -68,17 +145,26 @@ func Taylor(input string) bool {
 
 // Any returns true if the input is in any of the commands
 func Any(input string) bool {
+	if _, ok := Mode(input); ok {
+		return true
+	}
+	if Search(input) || Recopy(input) || Delete(input) || Verify(input) || Auth(input) || Config(input) || Profile(input) {
+		return true
+	}
 	var all []string
-	for _, v := range urlCommands {
+	for _, v := range deleteCommands {
 		all = append(all, v)
 	}
-	for _, v := range markdownCommands {
+	for _, v := range recentCommands {
 		all = append(all, v)
 	}
-	for _, v := range bbcodeCommands {
+	for _, v := range topCommands {
 		all = append(all, v)
 	}
-	for _, v := range deleteCommands {
+	for _, v := range historyCommands {
+		all = append(all, v)
+	}
+	for _, v := range backCommands {
 		all = append(all, v)
 	}
 	for _, v := range helpCommands {
@@ -106,12 +192,21 @@ func Any(input string) bool {
 // HelpOutput outputs the entries for each command
 func HelpOutput() string {
 	output := "Supported Commands:\n"
-	output += fmt.Sprintf(" %v - Shift to URL Mode\n", strings.Join(urlCommands[:], ", "))
-	output += fmt.Sprintf(" %v - Shift to Markdown Mode\n", strings.Join(markdownCommands[:], ", "))
-	output += fmt.Sprintf(" %v - Shift to BBCode Mode\n", strings.Join(bbcodeCommands[:], ", "))
-	output += fmt.Sprintf(" %v - Delete Last Record\n", strings.Join(deleteCommands[:], ", "))
+	for _, f := range formats.All() {
+		output += fmt.Sprintf(" %v - Shift to %v Mode\n", strings.Join(f.Names(), ", "), f.Description)
+	}
+	output += fmt.Sprintf(" %v [N] - Delete Last Record (or Number N from History)\n", strings.Join(deleteCommands[:], ", "))
+	output += fmt.Sprintf(" %v - Gifs Processed This Session\n", strings.Join(historyCommands[:], ", "))
+	output += fmt.Sprintf(" %v - Go Back to the Previous Gif\n", strings.Join(backCommands[:], ", "))
+	output += fmt.Sprintf(" %v N - Copy Number N from History\n", strings.Join(recopyCommands[:], ", "))
+	output += fmt.Sprintf(" %v <terms> - Search Names & Tags (Pick a Result by Number)\n", strings.Join(searchCommands[:], ", "))
+	output += fmt.Sprintf(" %v - Most Recently Copied Gifs\n", strings.Join(recentCommands[:], ", "))
+	output += fmt.Sprintf(" %v - Most Frequently Copied Gifs\n", strings.Join(topCommands[:], ", "))
+	output += fmt.Sprintf(" %v [purge|relink] - Check Every Link (and Purge or Relink the Dead Ones)\n", strings.Join(verifyCommands[:], ", "))
 	output += fmt.Sprintf(" %v - Database Record Count\n", strings.Join(countCommands[:], ", "))
-	output += fmt.Sprintf(" %v - Loaded Configuration\n", strings.Join(configCommands[:], ", "))
+	output += fmt.Sprintf(" %v [--sources] - Loaded Configuration (and Where Each Setting Came From)\n", strings.Join(configCommands[:], ", "))
+	output += fmt.Sprintf(" %v [name] - List Profiles (or Switch to One)\n", strings.Join(profileCommands[:], ", "))
+	output += fmt.Sprintf(" %v [code] - Log In with Dropbox (Then Enter the Code It Gives You)\n", strings.Join(authCommands[:], ", "))
 	output += fmt.Sprintf(" %v - Version Details\n", strings.Join(versionCommands[:], ", "))
 	output += fmt.Sprintf(" %v - Exit Program\n", strings.Join(exitCommands[:], ", "))
 	output += fmt.Sprintf(" %v - Help (This Menu)\n", strings.Join(helpCommands[:], ", "))
@@ -119,6 +214,17 @@ func HelpOutput() string {
 	return output
 }
 
+// returns the first word of the input
+func command(input string) string {
+	return strings.SplitN(strings.TrimSpace(input), " ", 2)[0]
+}
+
+// returns whether the passed input is a command for the named mode
+func isMode(input string, name string) bool {
+	f, ok := Mode(input)
+	return ok && f.Name == name
+}
+
 // returns whether the passed input (or a variant) exists in the commands slice
 func supported(input string, commands []string) (exists bool) {
 	if strings.HasPrefix(input, ":") {
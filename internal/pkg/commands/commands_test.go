@@ -9,14 +9,17 @@ import (
 
 func TestSupportedCommands(t *testing.T) {
 	assert.Equal(t, [4]string{"exit", "e", "quit", "q"}, exitCommands)
-	assert.Equal(t, [2]string{"url", "u"}, urlCommands)
-	assert.Equal(t, [2]string{"md", "m"}, markdownCommands)
-	assert.Equal(t, [2]string{"bbcode", "b"}, bbcodeCommands)
 	assert.Equal(t, [2]string{"delete", "del"}, deleteCommands)
 	assert.Equal(t, [2]string{"version", "v"}, versionCommands)
 	assert.Equal(t, [2]string{"help", "?"}, helpCommands)
 	assert.Equal(t, [2]string{"config", "details"}, configCommands)
 	assert.Equal(t, [2]string{"count", "gifs"}, countCommands)
+	assert.Equal(t, [2]string{"search", "find"}, searchCommands)
+	assert.Equal(t, [2]string{"recent", "r"}, recentCommands)
+	assert.Equal(t, [2]string{"top", "t"}, topCommands)
+	assert.Equal(t, [2]string{"history", "hist"}, historyCommands)
+	assert.Equal(t, [2]string{"back", "undo"}, backCommands)
+	assert.Equal(t, [2]string{"recopy", "rc"}, recopyCommands)
 	assert.Equal(t, [4]string{"taylor", "taylorswift", "taylor swift", "swiftie"}, taylorCommands)
 }
 
@@ -106,6 +109,7 @@ func TestDelete(t *testing.T) {
 	assert.True(Delete("del"))
 	assert.True(Delete(":delete"))
 	assert.True(Delete(":del"))
+	assert.True(Delete("delete 2"))
 
 	assert.False(Delete("url"))
 	assert.False(Delete("md"))
@@ -142,6 +146,8 @@ func TestConfig(t *testing.T) {
 
 	assert.True(Config("config"))
 	assert.True(Config("details"))
+	assert.True(Config("config --sources"))
+	assert.True(Any("config sources"))
 
 	assert.False(Config("url"))
 	assert.False(Config("md"))
@@ -152,6 +158,7 @@ func TestConfig(t *testing.T) {
 	assert.False(Config("count"))
 	assert.False(Config("version"))
 	assert.False(Config("taylor"))
+	assert.False(Config("configure"))
 }
 
 func TestCount(t *testing.T) {
@@ -213,6 +220,16 @@ func TestAny(t *testing.T) {
 	assert.True(t, Any("count"))
 	assert.True(t, Any("version"))
 	assert.True(t, Any("taylor"))
+	assert.True(t, Any("slack"))
+	assert.True(t, Any("search taylor"))
+	assert.True(t, Any("recent"))
+	assert.True(t, Any("top"))
+	assert.True(t, Any("history"))
+	assert.True(t, Any("undo"))
+	assert.True(t, Any("recopy 3"))
+	assert.True(t, Any("delete 2"))
+
+	assert.False(t, Any("/path/to/file.gif"))
 }
 
 func TestSupported(t *testing.T) {
@@ -229,9 +246,157 @@ func TestSupported(t *testing.T) {
 	assert.False(t, supported(":awesome", commands[:]))
 }
 
+func TestSearch(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Search("search"))
+	assert.True(Search("search shake it off"))
+	assert.True(Search(":find taylor"))
+
+	assert.False(Search("searching"))
+	assert.False(Search("url"))
+	assert.False(Search("/path/to/search.gif"))
+}
+
+func TestRecent(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Recent("recent"))
+	assert.True(Recent(":r"))
+
+	assert.False(Recent("top"))
+	assert.False(Recent("search"))
+	assert.False(Recent("url"))
+}
+
+func TestTop(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Top("top"))
+	assert.True(Top(":t"))
+
+	assert.False(Top("recent"))
+	assert.False(Top("taylor"))
+	assert.False(Top("url"))
+}
+
+func TestHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(History("history"))
+	assert.True(History(":hist"))
+
+	assert.False(History("back"))
+	assert.False(History("recopy"))
+}
+
+func TestBack(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Back("back"))
+	assert.True(Back("undo"))
+	assert.True(Back(":undo"))
+
+	assert.False(Back("history"))
+	assert.False(Back("delete"))
+}
+
+func TestRecopy(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Recopy("recopy 2"))
+	assert.True(Recopy("rc 12"))
+	assert.True(Recopy("recopy"))
+
+	assert.False(Recopy("history"))
+	assert.False(Recopy("/path/to/recopy.gif"))
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Verify("verify"))
+	assert.True(Verify("verify purge"))
+	assert.True(Verify(":verify relink"))
+	assert.True(Any("verify relink"))
+
+	assert.False(Verify("verified"))
+	assert.False(Verify("/path/to/verify.gif"))
+}
+
+func TestAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Auth("auth"))
+	assert.True(Auth("login"))
+	assert.True(Auth("auth ABC123def"))
+	assert.True(Any("auth ABC123def"))
+
+	assert.False(Auth("author"))
+	assert.False(Auth("/path/to/auth.gif"))
+}
+
+func TestProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Profile("profile"))
+	assert.True(Profile("profile work"))
+	assert.True(Profile(":profile"))
+	assert.True(Any("profile work"))
+
+	assert.False(Profile("profiles"))
+	assert.False(Profile("/path/to/profile.gif"))
+}
+
+func TestArguments(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("shake it off", Arguments("search shake it off"))
+	assert.Equal("taylor", Arguments(" find   taylor "))
+	assert.Equal("", Arguments("search"))
+}
+
+func TestPick(t *testing.T) {
+	assert := assert.New(t)
+
+	number, ok := Pick("3")
+	assert.True(ok)
+	assert.Equal(3, number)
+
+	number, ok = Pick(" 12 ")
+	assert.True(ok)
+	assert.Equal(12, number)
+
+	_, ok = Pick("0")
+	assert.False(ok)
+	_, ok = Pick("-1")
+	assert.False(ok)
+	_, ok = Pick("three")
+	assert.False(ok)
+}
+
+func TestMode(t *testing.T) {
+	assert := assert.New(t)
+
+	f, ok := Mode("m")
+	assert.True(ok)
+	assert.Equal("md", f.Name)
+
+	f, ok = Mode(":html")
+	assert.True(ok)
+	assert.Equal("html", f.Name)
+
+	_, ok = Mode("delete")
+	assert.False(ok)
+	_, ok = Mode("exit")
+	assert.False(ok)
+}
+
 func TestHelpOutput(t *testing.T) {
 	assert := assert.New(t)
 
 	output := HelpOutput()
 	assert.True(strings.HasPrefix(output, "Supported Commands"))
+	assert.Contains(output, " md, m, markdown - Shift to Markdown Mode\n")
+	assert.Contains(output, " json - Shift to JSON Mode\n")
 }
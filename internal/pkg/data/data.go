@@ -3,11 +3,15 @@ package data
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"image/gif"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"unicode"
 )
 
 // Handler creates a new input handler
@@ -21,13 +25,7 @@ func NewHandler() Handler {
 
 // Clean cleans the input data
 func (h Handler) Clean(data string) (clean string, err error) {
-	clean = strings.TrimSpace(data)
-	if runtime.GOOS != "windows" {
-		clean = strings.Replace(clean, "\\", "", -1)
-	}
-	if h.hasApostrophes(clean) || h.hasQuotes(clean) {
-		clean = clean[1 : len(clean)-1]
-	}
+	clean = h.strip(data)
 	if !h.isGif(clean) {
 		err = fmt.Errorf("not a gif [%v]", clean)
 	}
@@ -37,6 +35,146 @@ func (h Handler) Clean(data string) (clean string, err error) {
 	return
 }
 
+// Paths breaks the input down into every gif it references. Paths can be
+// shell-escaped, quoted, or newline separated, and directories are expanded
+// into the gifs they contain.
+func (h Handler) Paths(data string) (paths []string, err error) {
+	var found []string
+	for _, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		found, err = h.linePaths(line)
+		if err != nil {
+			return
+		}
+		paths = append(paths, found...)
+	}
+	if len(paths) == 0 {
+		err = errors.New("no gifs detected")
+	}
+	return
+}
+
+func (h Handler) linePaths(line string) (paths []string, err error) {
+	paths, err = h.wordPaths(h.split(line))
+	if err == nil {
+		return
+	}
+	// fall back to a single gif or directory with unescaped spaces
+	if clean, cleanErr := h.Clean(line); cleanErr == nil {
+		return []string{clean}, nil
+	}
+	if h.isDir(h.strip(line)) {
+		return h.dirGifs(h.strip(line))
+	}
+	return
+}
+
+func (h Handler) wordPaths(words []string) (paths []string, err error) {
+	var gifs []string
+	for _, word := range words {
+		gifs, err = h.Expand(word)
+		if err != nil {
+			return
+		}
+		paths = append(paths, gifs...)
+	}
+	return
+}
+
+// Expand returns the gifs a single, already-cleaned path refers to
+func (h Handler) Expand(path string) (gifs []string, err error) {
+	if h.isDir(path) {
+		return h.dirGifs(path)
+	}
+	if !h.isGif(path) {
+		err = fmt.Errorf("not a gif [%v]", path)
+		return
+	}
+	gifs = append(gifs, path)
+	return
+}
+
+// dirGifs returns every gif in the directory tree, skipping hidden directories
+func (h Handler) dirGifs(dir string) (gifs []string, err error) {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if h.isGif(path) {
+			gifs = append(gifs, path)
+		}
+		return nil
+	})
+	if err == nil && len(gifs) == 0 {
+		err = fmt.Errorf("no gifs found in %v", dir)
+	}
+	return
+}
+
+// split breaks a line into shell-style words, honoring quotes and escapes
+func (h Handler) split(line string) (words []string) {
+	var word strings.Builder
+	var quote rune
+	var escaped, inWord bool
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && runtime.GOOS != "windows":
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return
+}
+
+// strip removes surrounding whitespace, quotes, and escapes
+func (h Handler) strip(data string) (clean string) {
+	clean = strings.TrimSpace(data)
+	if runtime.GOOS != "windows" {
+		clean = strings.Replace(clean, "\\", "", -1)
+	}
+	if len(clean) > 1 && (h.hasApostrophes(clean) || h.hasQuotes(clean)) {
+		clean = clean[1 : len(clean)-1]
+	}
+	return
+}
+
+func (h Handler) isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
 func (h Handler) isGif(filename string) bool {
 	return strings.HasSuffix(strings.ToLower(filename), ".gif")
 }
@@ -70,3 +208,18 @@ func (h Handler) MD5Checksum(filePath string) (string, error) {
 
 	return returnMD5String, nil
 }
+
+// Dimensions returns the width and height of the gif
+func (h Handler) Dimensions(filePath string) (width int, height int, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	config, err := gif.DecodeConfig(file)
+	if err != nil {
+		return
+	}
+	return config.Width, config.Height, nil
+}
@@ -36,6 +36,64 @@ func TestDataClean(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("multiple gifs detected in %v", badGif), err.Error())
 }
 
+func TestDataPaths(t *testing.T) {
+	assert := assert.New(t)
+
+	paths, err := h.Paths("/path/to/file\\ name.gif")
+	assert.Nil(err)
+	assert.Equal([]string{"/path/to/file name.gif"}, paths)
+
+	paths, err = h.Paths("/path/to/file name.gif")
+	assert.Nil(err)
+	assert.Equal([]string{"/path/to/file name.gif"}, paths)
+
+	paths, err = h.Paths("/path/to/one.gif /path/to/file\\ two.gif '/path/to/three.gif' \"/path/to/four four.gif\"")
+	assert.Nil(err)
+	assert.Equal([]string{"/path/to/one.gif", "/path/to/file two.gif", "/path/to/three.gif", "/path/to/four four.gif"}, paths)
+
+	paths, err = h.Paths("/path/to/one.gif\n\n'/path/to/two two.gif'\n")
+	assert.Nil(err)
+	assert.Equal([]string{"/path/to/one.gif", "/path/to/two two.gif"}, paths)
+
+	paths, err = h.Paths("./fixtures/gifs")
+	assert.Nil(err)
+	assert.Equal([]string{"fixtures/gifs/nested/three four.gif", "fixtures/gifs/one.gif", "fixtures/gifs/two.gif"}, paths)
+
+	paths, err = h.Paths("./fixtures/gifs/nested /path/to/one.gif")
+	assert.Nil(err)
+	assert.Equal([]string{"fixtures/gifs/nested/three four.gif", "/path/to/one.gif"}, paths)
+
+	_, err = h.Paths("/path/to/one.gif /path/to/notes.txt")
+	assert.NotNil(err)
+	assert.Equal("not a gif [/path/to/notes.txt]", err.Error())
+
+	_, err = h.Paths(" \n ")
+	assert.NotNil(err)
+	assert.Equal("no gifs detected", err.Error())
+}
+
+func TestDataExpand(t *testing.T) {
+	assert := assert.New(t)
+
+	gifs, err := h.Expand("/path/to/it's a gif.gif")
+	assert.Nil(err)
+	assert.Equal([]string{"/path/to/it's a gif.gif"}, gifs)
+
+	gifs, err = h.Expand("fixtures/gifs/nested")
+	assert.Nil(err)
+	assert.Equal([]string{"fixtures/gifs/nested/three four.gif"}, gifs)
+
+	_, err = h.Expand("fixtures/gifs/notes.txt")
+	assert.NotNil(err)
+	assert.Equal("not a gif [fixtures/gifs/notes.txt]", err.Error())
+}
+
+func TestDataSplit(t *testing.T) {
+	assert.Equal(t, []string{"a b.gif", "c.gif", "d e.gif"}, h.split("a\\ b.gif  c.gif\t'd e.gif'"))
+	assert.Equal(t, []string{"it's.gif"}, h.split("it\\'s.gif"))
+	assert.Equal(t, []string(nil), h.split("   "))
+}
+
 func TestDataIsGif(t *testing.T) {
 	assert.True(t, h.isGif("sample.gif"))
 	assert.True(t, h.isGif("sample.GIF"))
@@ -71,6 +129,19 @@ func TestDataMD5Checksum(t *testing.T) {
 	assert.Equal(t, "open ./fixtures/missing_file.txt: no such file or directory", err.Error())
 }
 
+func TestDataDimensions(t *testing.T) {
+	width, height, err := h.Dimensions("./fixtures/gifs/one.gif")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, width)
+	assert.Equal(t, 3, height)
+
+	_, _, err = h.Dimensions("./fixtures/checksum_test.txt")
+	assert.NotNil(t, err)
+
+	_, _, err = h.Dimensions("./fixtures/missing_file.gif")
+	assert.NotNil(t, err)
+}
+
 func dirtyData() []string {
 	data := make([]string, 0)
 	data = append(data, "/path/to/file name.gif")
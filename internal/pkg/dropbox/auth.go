@@ -0,0 +1,303 @@
+package dropbox
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var authorizeURL = "https://www.dropbox.com/oauth2/authorize"
+
+// ErrNotLoggedIn is returned when there is no token to make requests with
+var ErrNotLoggedIn = errors.New("not logged in to Dropbox")
+
+// tokens are refreshed a little before they expire, so they don't expire mid-request
+var refreshMargin = time.Minute
+
+var now = time.Now
+
+// Credentials are the tokens from logging in with Dropbox
+type Credentials struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// expired returns whether the access token has expired, or is about to
+func (c Credentials) expired() bool {
+	return !c.ExpiresAt.IsZero() && now().Add(refreshMargin).After(c.ExpiresAt)
+}
+
+// Login is an OAuth2 PKCE code flow in progress. The user allows access at
+// the URL, then enters the code Dropbox shows them.
+type Login struct {
+	AppKey   string
+	verifier string
+}
+
+// NewLogin starts logging in with the app
+func NewLogin(appKey string) (login Login, err error) {
+	if appKey == "" {
+		err = errors.New("set app_key in your config to the App key from the Dropbox app console")
+		return
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	login.AppKey = appKey
+	login.verifier = base64.RawURLEncoding.EncodeToString(secret)
+	return
+}
+
+// challenge is the hash of the verifier, which Dropbox checks against the verifier later
+func (l Login) challenge() string {
+	sum := sha256.Sum256([]byte(l.verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// URL returns the page where the user allows access, and gets the code
+func (l Login) URL() string {
+	query := url.Values{
+		"client_id":             {l.AppKey},
+		"response_type":         {"code"},
+		"code_challenge":        {l.challenge()},
+		"code_challenge_method": {"S256"},
+		"token_access_type":     {"offline"},
+	}
+	return fmt.Sprintf("%v?%v", authorizeURL, query.Encode())
+}
+
+// tokens hands out the access token, refreshing it when it expires, and
+// saving the credentials whenever they change
+type tokens struct {
+	mutex       sync.Mutex
+	appKey      string
+	path        string
+	fallback    CredentialProvider
+	credentials Credentials
+}
+
+// newTokens loads the saved credentials for the app, if there are any. Without
+// any, the fallback supplies the token.
+func newTokens(appKey string, path string, fallback CredentialProvider) *tokens {
+	t := &tokens{appKey: appKey, path: path, fallback: fallback}
+	if raw, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(raw, &t.credentials)
+	}
+	return t
+}
+
+// loggedIn returns whether there are credentials from logging in
+func (t *tokens) loggedIn() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.credentials.RefreshToken != "" || t.credentials.AccessToken != ""
+}
+
+// access returns the access token, refreshing it first if it has expired
+func (t *tokens) access(ctx context.Context, c Client) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.credentials.AccessToken == "" && t.credentials.RefreshToken == "" {
+		if t.fallback == nil {
+			return "", ErrNotLoggedIn
+		}
+		return t.fallback.Token()
+	}
+	if t.credentials.expired() || t.credentials.AccessToken == "" {
+		if err := t.refreshLocked(ctx, c); err != nil {
+			return "", err
+		}
+	}
+	return t.credentials.AccessToken, nil
+}
+
+// refresh swaps the refresh token for a new access token, unless the access
+// token has already changed from the stale one
+func (t *tokens) refresh(ctx context.Context, c Client, stale string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.credentials.AccessToken != stale {
+		return nil
+	}
+	return t.refreshLocked(ctx, c)
+}
+
+func (t *tokens) refreshLocked(ctx context.Context, c Client) error {
+	if t.credentials.RefreshToken == "" {
+		return fmt.Errorf("%w: the access token has expired, with no refresh token", ErrNotLoggedIn)
+	}
+	refreshed, err := c.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.credentials.RefreshToken},
+		"client_id":     {t.appKey},
+	})
+	if err != nil {
+		return err
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = t.credentials.RefreshToken
+	}
+	return t.saveLocked(refreshed)
+}
+
+// save keeps the credentials, in memory and on disk
+func (t *tokens) save(credentials Credentials) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.saveLocked(credentials)
+}
+
+func (t *tokens) saveLocked(credentials Credentials) error {
+	t.credentials = credentials
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+		return err
+	}
+	temp := t.path + ".tmp"
+	if err = ioutil.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, t.path)
+}
+
+// NewLogin starts logging in with the app key from the config
+func (c Client) NewLogin() (Login, error) {
+	return NewLogin(c.Config.AppKey())
+}
+
+// Login finishes logging in with the code the user was given, saving the
+// credentials for later
+func (c Client) Login(ctx context.Context, login Login, code string) error {
+	if c.tokens == nil {
+		return errors.New("set app_key in your config to the App key from the Dropbox app console")
+	}
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return errors.New("no code to log in with")
+	}
+	credentials, err := c.requestToken(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {login.verifier},
+		"client_id":     {login.AppKey},
+	})
+	if err != nil {
+		return err
+	}
+	return c.tokens.save(credentials)
+}
+
+// LoggedIn returns whether the client has credentials from logging in, rather
+// than a pasted token
+func (c Client) LoggedIn() bool {
+	return c.tokens != nil && c.tokens.loggedIn()
+}
+
+// accessToken returns the token to authorize requests with
+func (c Client) accessToken(ctx context.Context) (string, error) {
+	if c.tokens != nil {
+		return c.tokens.access(ctx, c)
+	}
+	if c.credentials == nil {
+		return c.Config.Credentials().Token()
+	}
+	return c.credentials.Token()
+}
+
+// Unlock supplies the token up front, unless logged in, so any passphrase is
+// asked for (or token_command run) before it would interrupt something else
+func (c Client) Unlock() error {
+	if c.LoggedIn() {
+		return nil
+	}
+	_, err := c.accessToken(context.Background())
+	return err
+}
+
+// TokenSource describes where the token comes from, without giving it away
+func (c Client) TokenSource() string {
+	if c.credentials == nil {
+		return c.Config.Credentials().String()
+	}
+	return c.credentials.String()
+}
+
+// requestToken asks for new credentials with the form
+func (c Client) requestToken(ctx context.Context, form url.Values) (credentials Credentials, err error) {
+	u := c.apiURL()
+	u.Path = "oauth2/token"
+	request, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("User-Agent", "Dropbox Gif Linker")
+	result, err := c.httpClient().Do(request.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer result.Body.Close()
+	rawBody, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		return
+	}
+	var answer struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Error        string `json:"error"`
+		Description  string `json:"error_description"`
+	}
+	json.Unmarshal(rawBody, &answer)
+	if result.StatusCode != http.StatusOK || answer.AccessToken == "" {
+		err = oauthError(result.StatusCode, answer.Error, answer.Description)
+		return
+	}
+	credentials.AccessToken = answer.AccessToken
+	credentials.RefreshToken = answer.RefreshToken
+	if answer.ExpiresIn > 0 {
+		credentials.ExpiresAt = now().Add(time.Duration(answer.ExpiresIn) * time.Second)
+	}
+	return
+}
+
+// oauthError explains why Dropbox wouldn't hand out a token. A refused grant
+// means the code or refresh token is no good, so logging in again is the fix.
+func oauthError(status int, code string, description string) error {
+	if code == "" {
+		return fmt.Errorf("dropbox returned a %d", status)
+	}
+	if description == "" {
+		description = code
+	}
+	if code == "invalid_grant" {
+		return fmt.Errorf("%w (%v)", ErrNotLoggedIn, description)
+	}
+	return fmt.Errorf("dropbox returned a %d (%v)", status, description)
+}
+
+// tokensFor returns the tokens for the config, when it logs in with an app,
+// falling back to the credentials
+func tokensFor(config configInterface, fallback CredentialProvider) *tokens {
+	if config.AppKey() == "" {
+		return nil
+	}
+	return newTokens(config.AppKey(), config.CredentialsPath(), fallback)
+}
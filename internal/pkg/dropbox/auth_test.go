@@ -0,0 +1,258 @@
+package dropbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loginConfig logs in with an app, saving the credentials to its path
+type loginConfig struct {
+	testConfig
+	path string
+}
+
+func (l loginConfig) AppKey() string {
+	return "APP_KEY"
+}
+func (l loginConfig) CredentialsPath() string {
+	return l.path
+}
+
+func newLoginClient(t *testing.T, credentials *Credentials) (c Client, credentialsPath string) {
+	dir, err := ioutil.TempDir("", "dropbox-auth")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	credentialsPath = filepath.Join(dir, ".dgl", "credentials.json")
+	if credentials != nil {
+		os.MkdirAll(filepath.Dir(credentialsPath), 0700)
+		data, _ := json.Marshal(credentials)
+		ioutil.WriteFile(credentialsPath, data, 0600)
+	}
+	c = newClient(loginConfig{validConfig, credentialsPath})
+	return
+}
+
+func savedCredentials(t *testing.T, path string) (credentials Credentials) {
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	json.Unmarshal(data, &credentials)
+	return
+}
+
+// stubOAuth answers the token endpoint with the tokens, and list_shared_links
+// with no links when the request has the current access token, recording each
+// call along with its token or grant
+func stubOAuth(current string, answers map[string]string) (*httptest.Server, *[]string) {
+	var mutex sync.Mutex
+	calls := &[]string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/oauth2/token" {
+			r.ParseForm()
+			grant := r.PostForm.Get("grant_type")
+			*calls = append(*calls, fmt.Sprintf("token %v", grant))
+			answer, ok := answers[grant]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "invalid_grant", "error_description": "refresh token is malformed"}`))
+				return
+			}
+			w.Write([]byte(answer))
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		*calls = append(*calls, fmt.Sprintf("%v %v", path.Base(r.URL.Path), token))
+		if token != current {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(expiredTokenResponse()))
+			return
+		}
+		w.Write([]byte(`{"links": [], "has_more": false}`))
+	})), calls
+}
+
+func TestNewLogin(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewLogin("")
+	assert.Equal("set app_key in your config to the App key from the Dropbox app console", err.Error())
+
+	login, err := NewLogin("APP_KEY")
+	assert.Nil(err)
+	assert.Len(login.verifier, 43)
+	other, _ := NewLogin("APP_KEY")
+	assert.NotEqual(login.verifier, other.verifier)
+
+	u, err := url.Parse(login.URL())
+	assert.Nil(err)
+	assert.Equal("www.dropbox.com", u.Host)
+	assert.Equal("/oauth2/authorize", u.Path)
+	query := u.Query()
+	assert.Equal("APP_KEY", query.Get("client_id"))
+	assert.Equal("code", query.Get("response_type"))
+	assert.Equal("S256", query.Get("code_challenge_method"))
+	assert.Equal(login.challenge(), query.Get("code_challenge"))
+	assert.Equal("offline", query.Get("token_access_type"))
+}
+
+func TestLoginChallenge(t *testing.T) {
+	// from RFC 7636, appendix B
+	login := Login{verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", login.challenge())
+}
+
+func TestClientLogin(t *testing.T) {
+	assert := assert.New(t)
+	c, credentialsPath := newLoginClient(t, nil)
+	assert.False(c.LoggedIn())
+
+	var form url.Values
+	apiStub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"access_token": "ACCESS", "refresh_token": "REFRESH", "expires_in": 14400}`))
+	}))
+	defer apiStub.Close()
+	c.Host = apiStub.URL
+
+	login, _ := c.NewLogin()
+	err := c.Login(context.Background(), login, " THE_CODE \n")
+	assert.Nil(err)
+	assert.True(c.LoggedIn())
+	assert.Equal("authorization_code", form.Get("grant_type"))
+	assert.Equal("THE_CODE", form.Get("code"))
+	assert.Equal(login.verifier, form.Get("code_verifier"))
+	assert.Equal("APP_KEY", form.Get("client_id"))
+
+	saved := savedCredentials(t, credentialsPath)
+	assert.Equal("ACCESS", saved.AccessToken)
+	assert.Equal("REFRESH", saved.RefreshToken)
+	assert.WithinDuration(time.Now().Add(4*time.Hour), saved.ExpiresAt, time.Minute)
+	info, err := os.Stat(credentialsPath)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	err = c.Login(context.Background(), login, " ")
+	assert.Equal("no code to log in with", err.Error())
+
+	err = newClient(validConfig).Login(context.Background(), login, "THE_CODE")
+	assert.Equal("set app_key in your config to the App key from the Dropbox app console", err.Error())
+}
+
+func TestClientLoginRefused(t *testing.T) {
+	c, _ := newLoginClient(t, nil)
+	apiStub, _ := stubOAuth("ACCESS", nil)
+	defer apiStub.Close()
+	c.Host = apiStub.URL
+
+	login, _ := c.NewLogin()
+	err := c.Login(context.Background(), login, "THE_CODE")
+	assert.True(t, errors.Is(err, ErrNotLoggedIn))
+	assert.Equal(t, "not logged in to Dropbox (refresh token is malformed)", err.Error())
+	assert.False(t, c.LoggedIn())
+}
+
+func TestClientRefreshesExpiredToken(t *testing.T) {
+	assert := assert.New(t)
+	c, credentialsPath := newLoginClient(t, &Credentials{AccessToken: "OLD", RefreshToken: "REFRESH"})
+	apiStub, calls := stubOAuth("NEW", map[string]string{
+		"refresh_token": `{"access_token": "NEW", "expires_in": 14400}`,
+	})
+	defer apiStub.Close()
+	c.Host = apiStub.URL
+
+	_, err := c.exists(context.Background(), existingFile)
+	assert.Equal(fmt.Sprintf("no existing link for %v", existingFile), err.Error())
+	assert.Equal([]string{"list_shared_links OLD", "token refresh_token", "list_shared_links NEW"}, *calls)
+
+	saved := savedCredentials(t, credentialsPath)
+	assert.Equal("NEW", saved.AccessToken)
+	assert.Equal("REFRESH", saved.RefreshToken)
+
+	// the new token is used from then on
+	*calls = nil
+	c.exists(context.Background(), existingFile)
+	assert.Equal([]string{"list_shared_links NEW"}, *calls)
+}
+
+func TestClientRefreshesBeforeExpiring(t *testing.T) {
+	c, _ := newLoginClient(t, &Credentials{AccessToken: "OLD", RefreshToken: "REFRESH", ExpiresAt: time.Now().Add(30 * time.Second)})
+	apiStub, calls := stubOAuth("NEW", map[string]string{
+		"refresh_token": `{"access_token": "NEW", "expires_in": 14400}`,
+	})
+	defer apiStub.Close()
+	c.Host = apiStub.URL
+
+	c.exists(context.Background(), existingFile)
+	assert.Equal(t, []string{"token refresh_token", "list_shared_links NEW"}, *calls)
+}
+
+func TestClientRefreshRefused(t *testing.T) {
+	c, credentialsPath := newLoginClient(t, &Credentials{AccessToken: "OLD", RefreshToken: "REVOKED"})
+	apiStub, calls := stubOAuth("NEW", nil)
+	defer apiStub.Close()
+	c.Host = apiStub.URL
+
+	_, err := c.exists(context.Background(), existingFile)
+	assert.True(t, errors.Is(err, ErrNotLoggedIn))
+	assert.Equal(t, []string{"list_shared_links OLD", "token refresh_token"}, *calls)
+	assert.Equal(t, "OLD", savedCredentials(t, credentialsPath).AccessToken)
+}
+
+func TestClientWithoutLogin(t *testing.T) {
+	assert := assert.New(t)
+
+	// without credentials or a token
+	c := newClient(loginConfig{testConfig{fullPath, gifDir, "", true}, filepath.Join(os.TempDir(), "missing", "credentials.json")})
+	_, err := c.exists(context.Background(), existingFile)
+	assert.Equal(ErrNotLoggedIn, err)
+
+	// with a token, but no credentials
+	c = newClient(loginConfig{validConfig, filepath.Join(os.TempDir(), "missing", "credentials.json")})
+	apiStub, calls := stubOAuth(apiToken, nil)
+	defer apiStub.Close()
+	c.Host = apiStub.URL
+	c.exists(context.Background(), existingFile)
+	assert.Equal([]string{"list_shared_links " + apiToken}, *calls)
+	assert.False(c.LoggedIn())
+
+	// a pasted token that expired can't be refreshed
+	apiStub, calls = stubOAuth("NEW", nil)
+	c = newClient(validConfig)
+	c.Host = apiStub.URL
+	_, err = c.exists(context.Background(), existingFile)
+	assert.True(errors.Is(err, ErrTokenExpired))
+	assert.Equal([]string{"list_shared_links " + apiToken}, *calls)
+}
+
+func TestConfigAppKey(t *testing.T) {
+	assert := assert.New(t)
+
+	d, _ := createFromConfig(fixturePath("app_key"))
+	ok, err := d.validate()
+	assert.True(ok)
+	assert.Nil(err)
+	assert.Equal("APP_KEY", d.AppKey())
+	assert.Equal("", d.Token())
+	assert.Equal(configPath(filepath.Join(".dgl", "credentials.json")), d.CredentialsPath())
+
+	d, _ = createFromConfig(validConfigFilename)
+	assert.Equal("", d.AppKey())
+}
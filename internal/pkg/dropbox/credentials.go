@@ -0,0 +1,295 @@
+package dropbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// DefaultTokenEnv is the environment variable checked for the API token when
+// the config doesn't name another one
+const DefaultTokenEnv = "DGL_API_TOKEN"
+
+// PassphraseEnv is the environment variable checked for the passphrase to the
+// encrypted token file, before asking for it
+const PassphraseEnv = "DGL_PASSPHRASE"
+
+// ErrWrongPassphrase is returned when the encrypted token file can't be decrypted
+var ErrWrongPassphrase = errors.New("the passphrase is wrong, or the token file is damaged")
+
+// keyIterations is how many rounds of PBKDF2 new token files are encrypted with
+var keyIterations = 600000
+
+// passphrasePrompt asks for the passphrase to the encrypted token file at the path
+var passphrasePrompt func(path string) (string, error)
+
+// SetPassphrasePrompt sets how the passphrase to the encrypted token file is
+// asked for, when it isn't in the environment
+func SetPassphrasePrompt(prompt func(path string) (string, error)) {
+	passphrasePrompt = prompt
+}
+
+// CredentialProvider supplies the API token from wherever it is kept
+type CredentialProvider interface {
+	// Token returns the API token
+	Token() (string, error)
+	// String describes where the token comes from, without giving it away
+	String() string
+}
+
+// StaticToken is a token written in the config
+type StaticToken string
+
+// Token returns the token, if there is one
+func (s StaticToken) Token() (string, error) {
+	if s == "" {
+		return "", ErrNotLoggedIn
+	}
+	return string(s), nil
+}
+
+// String returns the token masked, so it's recognizable without being usable
+func (s StaticToken) String() string {
+	return MaskToken(string(s))
+}
+
+// EnvToken is a token read from the environment variable it names
+type EnvToken string
+
+// Token returns the value of the environment variable
+func (e EnvToken) Token() (string, error) {
+	token := strings.TrimSpace(os.Getenv(string(e)))
+	if token == "" {
+		return "", fmt.Errorf("%w: $%v is not set", ErrNotLoggedIn, string(e))
+	}
+	return token, nil
+}
+
+// String names the environment variable
+func (e EnvToken) String() string {
+	return "$" + string(e)
+}
+
+// CommandToken is a token printed by a shell command, like a password manager's
+type CommandToken string
+
+// Token runs the command, returning the first line it prints. The command can
+// ask for input on the terminal, like a password manager unlocking its vault.
+func (c CommandToken) Token() (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.Command(shell, flag, string(c))
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("the token_command failed: %v", err)
+	}
+	token := strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0])
+	if token == "" {
+		return "", errors.New("the token_command printed no token")
+	}
+	return token, nil
+}
+
+// String says the token comes from the token_command, without the command,
+// which can hold secrets of its own
+func (c CommandToken) String() string {
+	return "token_command"
+}
+
+// EncryptedToken is a token kept in a file encrypted with a passphrase
+type EncryptedToken struct {
+	Path string
+	// Passphrase returns the passphrase to decrypt the file with
+	Passphrase func() (string, error)
+}
+
+// Token asks for the passphrase and decrypts the file
+func (e EncryptedToken) Token() (string, error) {
+	raw, err := ioutil.ReadFile(e.Path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the token_file: %v", err)
+	}
+	if e.Passphrase == nil {
+		return "", fmt.Errorf("set %v to the passphrase for %v", PassphraseEnv, e.Path)
+	}
+	passphrase, err := e.Passphrase()
+	if err != nil {
+		return "", err
+	}
+	return decryptToken(raw, passphrase)
+}
+
+// String names the file
+func (e EncryptedToken) String() string {
+	return fmt.Sprintf("%v (encrypted)", e.Path)
+}
+
+// cachedToken remembers the token once it's been supplied, so commands are
+// run and passphrases asked for only once
+type cachedToken struct {
+	mutex    sync.Mutex
+	provider CredentialProvider
+	token    string
+}
+
+// Token returns the remembered token, or supplies it
+func (c *cachedToken) Token() (token string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.token != "" {
+		return c.token, nil
+	}
+	token, err = c.provider.Token()
+	if err == nil {
+		c.token = token
+	}
+	return
+}
+
+func (c *cachedToken) String() string {
+	return c.provider.String()
+}
+
+// MaskToken hides all but the end of the token
+func MaskToken(token string) string {
+	if token == "" {
+		return "(none)"
+	}
+	if len(token) < 12 {
+		return strings.Repeat("*", len(token))
+	}
+	return strings.Repeat("*", 8) + token[len(token)-4:]
+}
+
+// tokenFile is how the encrypted token is kept on disk
+type tokenFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// EncryptToken writes the token to the path, encrypted with the passphrase
+func EncryptToken(path string, token string, passphrase string) (err error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return errors.New("no token to encrypt")
+	}
+	if passphrase == "" {
+		return errors.New("no passphrase to encrypt the token with")
+	}
+	file := tokenFile{Version: 1, Iterations: keyIterations, Salt: make([]byte, 16)}
+	if _, err = rand.Read(file.Salt); err != nil {
+		return
+	}
+	gcm, err := tokenCipher(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(file.Nonce); err != nil {
+		return
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, []byte(token), nil)
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	temp := path + ".tmp"
+	if err = ioutil.WriteFile(temp, data, 0600); err != nil {
+		return
+	}
+	return os.Rename(temp, path)
+}
+
+func decryptToken(raw []byte, passphrase string) (token string, err error) {
+	var file tokenFile
+	if err = json.Unmarshal(raw, &file); err != nil || file.Version != 1 {
+		return "", errors.New("the token_file isn't one written by encrypt-token")
+	}
+	gcm, err := tokenCipher(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return "", ErrWrongPassphrase
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(plain), nil
+}
+
+// tokenCipher derives the key from the passphrase
+func tokenCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations < 1 || len(salt) == 0 {
+		return nil, errors.New("the token_file isn't one written by encrypt-token")
+	}
+	block, err := aes.NewCipher(pbkdf2([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key of the length from the password, using HMAC-SHA256 (RFC 8018)
+func pbkdf2(password []byte, salt []byte, iterations int, length int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < length; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:length]
+}
+
+// passphrase returns the passphrase from the environment, or asks for it
+func passphrase(path string) func() (string, error) {
+	return func() (string, error) {
+		if value := os.Getenv(PassphraseEnv); value != "" {
+			return value, nil
+		}
+		if passphrasePrompt == nil {
+			return "", fmt.Errorf("set %v to the passphrase for %v", PassphraseEnv, path)
+		}
+		value, err := passphrasePrompt(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(value, "\r\n"), nil
+	}
+}
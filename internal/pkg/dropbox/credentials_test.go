@@ -0,0 +1,225 @@
+package dropbox
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenConfig gets its token from the credentials instead of the config
+type tokenConfig struct {
+	testConfig
+	credentials CredentialProvider
+}
+
+func (c tokenConfig) Credentials() CredentialProvider {
+	return c.credentials
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dropbox-credentials")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func setenv(t *testing.T, name string, value string) {
+	previous, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestMaskToken(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("(none)", MaskToken(""))
+	assert.Equal("*****", MaskToken("short"))
+	assert.Equal("********wxyz", MaskToken("sl.abcdefghijklmnopqrstuvwxyz"))
+	assert.Equal("********wxyz", StaticToken("sl.abcdefghijklmnopqrstuvwxyz").String())
+}
+
+func TestStaticToken(t *testing.T) {
+	assert := assert.New(t)
+	token, err := StaticToken("xxx").Token()
+	assert.Nil(err)
+	assert.Equal("xxx", token)
+
+	_, err = StaticToken("").Token()
+	assert.True(errors.Is(err, ErrNotLoggedIn))
+}
+
+func TestEnvToken(t *testing.T) {
+	assert := assert.New(t)
+	setenv(t, "DGL_TEST_TOKEN", " FROM_ENV\n")
+	token, err := EnvToken("DGL_TEST_TOKEN").Token()
+	assert.Nil(err)
+	assert.Equal("FROM_ENV", token)
+	assert.Equal("$DGL_TEST_TOKEN", EnvToken("DGL_TEST_TOKEN").String())
+
+	os.Unsetenv("DGL_TEST_TOKEN")
+	_, err = EnvToken("DGL_TEST_TOKEN").Token()
+	assert.True(errors.Is(err, ErrNotLoggedIn))
+	assert.Contains(err.Error(), "$DGL_TEST_TOKEN is not set")
+}
+
+func TestCommandToken(t *testing.T) {
+	assert := assert.New(t)
+	token, err := CommandToken("printf 'FROM_COMMAND\\nsecond line\\n'").Token()
+	assert.Nil(err)
+	assert.Equal("FROM_COMMAND", token)
+	assert.Equal("token_command", CommandToken("pass show dropbox").String())
+
+	_, err = CommandToken("exit 1").Token()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "token_command failed")
+
+	_, err = CommandToken("true").Token()
+	assert.Equal("the token_command printed no token", err.Error())
+}
+
+func TestEncryptedToken(t *testing.T) {
+	assert := assert.New(t)
+	defer func(iterations int) { keyIterations = iterations }(keyIterations)
+	keyIterations = 10
+	path := filepath.Join(tempDir(t), ".dgl", "token.enc")
+
+	assert.Nil(EncryptToken(path, "ENCRYPTED\n", "correct horse"))
+	info, err := os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	raw, _ := ioutil.ReadFile(path)
+	assert.NotContains(string(raw), "ENCRYPTED")
+
+	fixed := func(passphrase string) func() (string, error) {
+		return func() (string, error) { return passphrase, nil }
+	}
+	token, err := EncryptedToken{Path: path, Passphrase: fixed("correct horse")}.Token()
+	assert.Nil(err)
+	assert.Equal("ENCRYPTED", token)
+	assert.Equal(path+" (encrypted)", EncryptedToken{Path: path}.String())
+
+	_, err = EncryptedToken{Path: path, Passphrase: fixed("wrong horse")}.Token()
+	assert.Equal(ErrWrongPassphrase, err)
+
+	_, err = EncryptedToken{Path: path + ".missing", Passphrase: fixed("correct horse")}.Token()
+	assert.Contains(err.Error(), "unable to read the token_file")
+
+	ioutil.WriteFile(path, []byte("plain text"), 0600)
+	_, err = EncryptedToken{Path: path, Passphrase: fixed("correct horse")}.Token()
+	assert.Equal("the token_file isn't one written by encrypt-token", err.Error())
+
+	assert.Equal("no token to encrypt", EncryptToken(path, " ", "correct horse").Error())
+	assert.Equal("no passphrase to encrypt the token with", EncryptToken(path, "ENCRYPTED", "").Error())
+}
+
+func TestPassphrase(t *testing.T) {
+	assert := assert.New(t)
+	defer SetPassphrasePrompt(passphrasePrompt)
+
+	SetPassphrasePrompt(nil)
+	_, err := passphrase("token.enc")()
+	assert.Equal("set DGL_PASSPHRASE to the passphrase for token.enc", err.Error())
+
+	var asked []string
+	SetPassphrasePrompt(func(path string) (string, error) {
+		asked = append(asked, path)
+		return "typed\n", nil
+	})
+	value, err := passphrase("token.enc")()
+	assert.Nil(err)
+	assert.Equal("typed", value)
+	assert.Equal([]string{"token.enc"}, asked)
+
+	// the environment comes first
+	setenv(t, PassphraseEnv, "from env")
+	value, err = passphrase("token.enc")()
+	assert.Nil(err)
+	assert.Equal("from env", value)
+	assert.Len(asked, 1)
+}
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 7914, section 11
+	key := pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)
+	assert.Equal(t, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"+
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783", hex.EncodeToString(key))
+}
+
+func TestConfigCredentials(t *testing.T) {
+	assert := assert.New(t)
+	setenv(t, DefaultTokenEnv, "")
+	os.Unsetenv(DefaultTokenEnv)
+	d := Config{DropboxPath: "~/Dropbox", GifDir: "/gifs", Loaded: true}
+
+	// without a token from anywhere, the config is incomplete
+	_, err := d.validate()
+	assert.Equal("the config is incomplete", err.Error())
+
+	d.APIToken = "API_TOKEN"
+	assert.Equal(StaticToken("API_TOKEN"), d.Credentials())
+
+	d.TokenFile = "~/secrets/token.enc"
+	path, _ := filepath.Abs(configPath(filepath.Join("secrets", "token.enc")))
+	assert.Equal(path, d.TokenFilePath())
+	assert.Equal(path+" (encrypted)", d.Credentials().String())
+
+	d.TokenCmd = "pass show dropbox"
+	assert.Equal(CommandToken("pass show dropbox"), d.Credentials())
+
+	setenv(t, DefaultTokenEnv, "FROM_ENV")
+	assert.Equal(EnvToken(DefaultTokenEnv), d.Credentials())
+
+	d.TokenEnv = "DROPBOX_TOKEN"
+	assert.Equal(EnvToken("DROPBOX_TOKEN"), d.Credentials())
+
+	// any of them will do
+	for _, d := range []Config{
+		{TokenEnv: "DROPBOX_TOKEN"},
+		{TokenCmd: "pass show dropbox"},
+		{TokenFile: "~/token.enc"},
+	} {
+		os.Unsetenv(DefaultTokenEnv)
+		d.DropboxPath, d.GifDir, d.Loaded = "~/Dropbox", "/gifs", true
+		ok, err := d.validate()
+		assert.True(ok)
+		assert.Nil(err)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	runs := filepath.Join(dir, "runs")
+	command := CommandToken(fmt.Sprintf("echo run >> %v && echo FROM_COMMAND", runs))
+	apiStub, calls := stubOAuth("FROM_COMMAND", nil)
+	defer apiStub.Close()
+
+	c := newClient(tokenConfig{validConfig, command})
+	c.Host = apiStub.URL
+	assert.Equal("token_command", c.TokenSource())
+	assert.Nil(c.Unlock())
+	c.exists(context.Background(), existingFile)
+	c.exists(context.Background(), existingFile)
+	assert.Equal([]string{"list_shared_links FROM_COMMAND", "list_shared_links FROM_COMMAND"}, *calls)
+
+	// the command is only run once
+	raw, _ := ioutil.ReadFile(runs)
+	assert.Equal(1, strings.Count(string(raw), "run"))
+
+	c = newClient(tokenConfig{validConfig, EnvToken("DGL_TEST_MISSING")})
+	err := c.Unlock()
+	assert.True(errors.Is(err, ErrNotLoggedIn))
+}
@@ -2,6 +2,7 @@ package dropbox
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,19 +12,52 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/httpclient"
 )
 
 var configFilename = ".dgl.json"
 
 // Config is the object to be used when working with Client
 type Config struct {
-	DropboxPath string `json:"dropbox_path"`
-	GifDir      string `json:"dropbox_gif_dir"`
-	APIToken    string `json:"dropbox_api_token"`
-	Path        string
-	Loaded      bool
+	DropboxPath string            `json:"dropbox_path"`
+	GifDir      string            `json:"dropbox_gif_dir"`
+	APIToken    string            `json:"dropbox_api_token,omitempty"`
+	TokenEnv    string            `json:"token_env,omitempty"`
+	TokenCmd    string            `json:"token_command,omitempty"`
+	TokenFile   string            `json:"token_file,omitempty"`
+	App         string            `json:"app_key,omitempty"`
+	Templates   map[string]string `json:"templates,omitempty"`
+	StorageType string            `json:"storage,omitempty"`
+	Sync        bool              `json:"sync,omitempty"`
+	Machine     string            `json:"machine_name,omitempty"`
+	HTTP        *HTTPConfig       `json:"http,omitempty"`
+	Env         string            `json:"environment,omitempty"`
+	// DefaultProfile is the profile used unless another is asked for
+	DefaultProfile string `json:"profile,omitempty"`
+	// Profiles hold settings to use instead of the ones above, by name
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+	Path     string                     `json:"-"`
+	Loaded   bool                       `json:"-"`
+	// sources are where each setting came from, when not the default
+	sources map[string]string
+	// profile is the name of the profile in use
+	profile string
+	// profileCredentials is whether the profile has credentials of its own,
+	// which DGL_API_TOKEN doesn't replace
+	profileCredentials bool
+}
+
+// HTTPConfig tunes the requests made to Dropbox, with durations like "30s" or "500ms".
+// Anything left out uses the defaults.
+type HTTPConfig struct {
+	Timeout    string `json:"timeout,omitempty"`
+	Retries    *int   `json:"retries,omitempty"`
+	Backoff    string `json:"backoff,omitempty"`
+	MaxBackoff string `json:"max_backoff,omitempty"`
 }
 
 // Client for the Dropbox API interactions
@@ -31,20 +65,39 @@ type Client struct {
 	Host    string
 	Version int
 	Config  configInterface
+	HTTP    httpclient.Doer
+	tokens  *tokens
+	// credentials supply the token when not logged in
+	credentials CredentialProvider
 }
 
 type configInterface interface {
 	FullPath() string
 	GifsPath() string
-	Token() string
+	Credentials() CredentialProvider
+	AppKey() string
+	CredentialsPath() string
 	Valid() bool
 	Environment() string
 	DatabasePath() string
 	LoadedPath() string
+	OutputTemplates() map[string]string
+	Storage() string
+	SyncEnabled() bool
+	SyncDir() string
+	SyncStatePath() string
+	SharedDatabasePath() string
+	MachineName() string
+	HTTPSettings() httpclient.Settings
+	Settings() []Setting
+	Profile() string
+	ProfileNames() []string
 }
 
 type existingPayload struct {
-	RelativePath string `json:"path"`
+	RelativePath string `json:"path,omitempty"`
+	Cursor       string `json:"cursor,omitempty"`
+	DirectOnly   bool   `json:"direct_only,omitempty"`
 }
 
 type creationPayload struct {
@@ -56,11 +109,28 @@ type settingPayload struct {
 	Visibility string `json:"requested_visibility"`
 }
 
+type modificationPayload struct {
+	URL      string         `json:"url"`
+	Settings settingPayload `json:"settings"`
+}
+
 type existsResponse struct {
 	Links   []Link `json:"links"`
 	HasMore bool   `json:"has_more"`
+	Cursor  string `json:"cursor"`
+}
+
+// ListOptions narrow down the shared links listed
+type ListOptions struct {
+	// Path lists the links for a file (and the folders it's in), instead of every link
+	Path string
+	// DirectOnly leaves out the links for the folders the file is in
+	DirectOnly bool
 }
 
+// ErrStop can be returned while listing shared links to stop early, without an error
+var ErrStop = errors.New("stop listing")
+
 // Link is the data that is provided from the Dropbox API
 type Link struct {
 	Tag            string          `json:".tag"`
@@ -88,41 +158,69 @@ type LinkTag struct {
 	Tag string `json:".tag"`
 }
 
-// NewConfig attempts to load an existing configuration
+// NewConfig attempts to load an existing configuration, from the config file
+// and then the DGL_ environment variables, which override it. Without a file,
+// the environment variables can make up the whole config, unless the file was
+// asked for by --config or $DGL_CONFIG.
 func NewConfig() (d Config, err error) {
-	fullConfig := configPath(configFilename)
-	if _, err = os.Stat(fullConfig); os.IsNotExist(err) {
-		err = fmt.Errorf("Please setup your config file [%v]", fullConfig)
+	fullConfig, reason := ConfigFile()
+	d, err = createFromConfig(fullConfig)
+	if err != nil {
+		if reason == "--config" || reason == "$"+ConfigEnv || !os.IsNotExist(err) {
+			err = fmt.Errorf("unable to read the config from %v: %v", reason, err)
+			return
+		}
+		err = nil
+	}
+	if err = d.useProfile(d.selectProfile()); err != nil {
 		return
 	}
-	d, err = createFromConfig(fullConfig)
+	overridden, err := d.applyEnv()
 	if err != nil {
 		return
 	}
+	if !d.Loaded {
+		if overridden == 0 {
+			err = fmt.Errorf("Please setup your config file [%v], or run dropbox-gif-linker init", fullConfig)
+			return
+		}
+		d.Path, d.Loaded = "", true
+	}
 	d.gifDirFix()
-	if !d.Valid() {
-		err = fmt.Errorf("please validate the %v file. See README for details", fullConfig)
+	if _, invalid := d.validate(); invalid != nil {
+		err = fmt.Errorf("please validate the %v file (%v). See README for details", fullConfig, invalid)
 	}
 	return
 }
 
 // DefaultClient returns the client with the default config
 func DefaultClient() (c Client, err error) {
-	c.Host = "https://api.dropboxapi.com"
-	c.Version = 2
 	var d Config
 	d, err = NewConfig()
 	if err != nil {
 		return
 	}
-	c.Config = &d
-	return
+	return NewClient(d), nil
+}
+
+// NewClient returns a client with the config, like one being set up before it's saved
+func NewClient(d Config) Client {
+	return newClient(&d)
+}
+
+// DefaultConfigPath provides the full path to the config file that is loaded
+func DefaultConfigPath() string {
+	path, _ := ConfigFile()
+	return path
 }
 
 func newClient(config configInterface) (c Client) {
 	c.Host = "https://api.dropboxapi.com"
 	c.Version = 2
 	c.Config = config
+	c.HTTP = httpclient.New(config.HTTPSettings())
+	c.credentials = &cachedToken{provider: config.Credentials()}
+	c.tokens = tokensFor(config, c.credentials)
 	return
 }
 
@@ -152,16 +250,66 @@ func (c Config) GifsPath() string {
 	return ""
 }
 
-// DatabasePath provides the full path to the database file
+// DatabasePath provides the full path to the database file, which is kept out of
+// the Dropbox folder when syncing
 func (c Config) DatabasePath() string {
 	if !c.Valid() {
 		return ""
 	}
-	if c.Environment() == "test" {
-		wd, _ := os.Getwd()
-		return fmt.Sprintf("%v/%v.bolt.db", filepath.Join(wd, "../", "db"), c.Environment())
+	if c.Sync {
+		return c.databaseFile(configPath(".dgl"))
+	}
+	return c.SharedDatabasePath()
+}
+
+// SharedDatabasePath provides the full path to the database file in the Dropbox folder
+func (c Config) SharedDatabasePath() string {
+	if !c.Valid() {
+		return ""
+	}
+	return c.databaseFile(filepath.Join(c.FullPath(), ".gifs"))
+}
+
+func (c Config) databaseFile(dir string) string {
+	if c.Storage() == "json" {
+		return fmt.Sprintf("%v/gifs%v.json", dir, c.dataSuffix())
+	}
+	return fmt.Sprintf("%v/gifs%v.bolt.db", dir, c.dataSuffix())
+}
+
+// SyncEnabled returns whether each machine keeps a local database, exchanging changes
+// through the Dropbox folder
+func (c Config) SyncEnabled() bool {
+	return c.Valid() && c.Sync
+}
+
+// SyncDir provides the full path to the change logs in the Dropbox folder
+func (c Config) SyncDir() string {
+	if !c.Valid() {
+		return ""
 	}
-	return fmt.Sprintf("%v/gifs.bolt.db", filepath.Join(c.FullPath(), ".gifs"))
+	return filepath.Join(c.FullPath(), ".gifs", "sync"+c.dataSuffix())
+}
+
+// SyncStatePath provides the full path to the file remembering how far this machine
+// has synced, beside the local database
+func (c Config) SyncStatePath() string {
+	if !c.Valid() {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.DatabasePath()), fmt.Sprintf("sync%v.json", c.dataSuffix()))
+}
+
+// MachineName returns the name of this machine's change log, defaulting to the hostname
+func (c Config) MachineName() string {
+	if c.Machine != "" {
+		return c.Machine
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
 }
 
 // LoadedPath provides the full path to the loaded config file
@@ -172,7 +320,7 @@ func (c Config) LoadedPath() string {
 	return c.Path
 }
 
-// Token returns the api token for use in API calls
+// Token returns the api token written in the config, if there is one
 func (c Config) Token() string {
 	if c.Valid() {
 		return c.APIToken
@@ -180,9 +328,134 @@ func (c Config) Token() string {
 	return ""
 }
 
-// Environment returns the environment for the Config
+// Credentials returns where the api token comes from. The first of these is used:
+// the token_env variable (or DGL_API_TOKEN, when set), the token_command, the
+// encrypted token_file, then the dropbox_api_token.
+func (c Config) Credentials() CredentialProvider {
+	switch {
+	case c.TokenEnv != "":
+		return EnvToken(c.TokenEnv)
+	case os.Getenv(DefaultTokenEnv) != "" && !c.profileCredentials:
+		return EnvToken(DefaultTokenEnv)
+	case c.TokenCmd != "":
+		return CommandToken(c.TokenCmd)
+	case c.TokenFile != "":
+		path := c.TokenFilePath()
+		return EncryptedToken{Path: path, Passphrase: passphrase(path)}
+	}
+	return StaticToken(c.Token())
+}
+
+// TokenFilePath provides the full path to the encrypted token, defaulting to
+// one beside the login credentials
+func (c Config) TokenFilePath() string {
+	if c.TokenFile == "" {
+		return filepath.Join(configPath(".dgl"), fmt.Sprintf("token%v.enc", c.profileSuffix()))
+	}
+	path, err := homedir.Expand(c.TokenFile)
+	if err != nil {
+		return c.TokenFile
+	}
+	return path
+}
+
+// hasToken returns whether the config says where to find a token
+func (c Config) hasToken() bool {
+	return c.APIToken != "" || c.TokenEnv != "" || c.TokenCmd != "" || c.TokenFile != "" ||
+		os.Getenv(DefaultTokenEnv) != ""
+}
+
+// AppKey returns the key of the Dropbox app to log in with, if there is one
+func (c Config) AppKey() string {
+	if c.Valid() {
+		return c.App
+	}
+	return ""
+}
+
+// CredentialsPath provides the full path to the credentials saved by logging in
+func (c Config) CredentialsPath() string {
+	return filepath.Join(configPath(".dgl"), fmt.Sprintf("credentials%v.json", c.profileSuffix()))
+}
+
+// OutputTemplates returns the user-defined output templates, keyed by name
+func (c Config) OutputTemplates() map[string]string {
+	if c.Valid() {
+		return c.Templates
+	}
+	return nil
+}
+
+// Storage returns how the database is stored, either "bolt" (the default) or "json"
+func (c Config) Storage() string {
+	if c.StorageType == "" {
+		return "bolt"
+	}
+	return c.StorageType
+}
+
+// HTTPSettings returns how long requests to Dropbox can take, and how they are retried
+func (c Config) HTTPSettings() (settings httpclient.Settings) {
+	settings, _ = c.httpConfig().settings()
+	return
+}
+
+// httpConfig returns the http settings, which are all defaults when left out
+func (c Config) httpConfig() (h HTTPConfig) {
+	if c.HTTP != nil {
+		h = *c.HTTP
+	}
+	return
+}
+
+// settings fills in the defaults for anything left out
+func (h HTTPConfig) settings() (settings httpclient.Settings, err error) {
+	settings = httpclient.DefaultSettings
+	durations := []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{
+		{"timeout", h.Timeout, &settings.Timeout},
+		{"backoff", h.Backoff, &settings.Backoff},
+		{"max_backoff", h.MaxBackoff, &settings.MaxBackoff},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, parseErr := time.ParseDuration(d.value)
+		if parseErr != nil || duration <= 0 {
+			err = fmt.Errorf("the http %v should be a duration like \"30s\" instead of \"%v\"", d.name, d.value)
+			return httpclient.DefaultSettings, err
+		}
+		*d.into = duration
+	}
+	if h.Retries != nil {
+		if *h.Retries < 0 {
+			err = fmt.Errorf("the http retries should be 0 or more instead of %d", *h.Retries)
+			return httpclient.DefaultSettings, err
+		}
+		settings.Retries = *h.Retries
+	}
+	return
+}
+
+// Environment returns the environment for the Config, defaulting to production
 func (c Config) Environment() string {
-	return "development"
+	if c.Env == "" {
+		return Environments[0]
+	}
+	return c.Env
+}
+
+// dataSuffix sets the database and sync files of a profile, and of the development
+// environment, apart from the default ones
+func (c Config) dataSuffix() string {
+	if c.Environment() == "development" {
+		return c.profileSuffix() + "-development"
+	}
+	return c.profileSuffix()
 }
 
 // Valid returns whether the config is valid
@@ -196,7 +469,7 @@ func (c Config) validate() (ok bool, err error) {
 		err = errors.New("the config has yet to be loaded")
 		return
 	}
-	if c.DropboxPath == "" || c.GifDir == "" || c.APIToken == "" {
+	if c.DropboxPath == "" || c.GifDir == "" || (!c.hasToken() && c.App == "") {
 		err = errors.New("the config is incomplete")
 		return
 	}
@@ -208,6 +481,34 @@ func (c Config) validate() (ok bool, err error) {
 		err = fmt.Errorf("the dropbox_gif_dir should be \"%v%v\" instead of \"%v\"", string(os.PathSeparator), c.GifDir, c.GifDir)
 		return
 	}
+	if c.StorageType != "" && c.StorageType != "bolt" && c.StorageType != "json" {
+		err = fmt.Errorf("the storage should be \"bolt\" or \"json\" instead of \"%v\"", c.StorageType)
+		return
+	}
+	if c.Env != "" && !contains(Environments, c.Env) {
+		err = fmt.Errorf("the environment should be one of %v instead of \"%v\"", strings.Join(Environments, ", "), c.Env)
+		return
+	}
+	for name := range c.Profiles {
+		if name == "" || name == DefaultProfile || strings.ContainsAny(name, " \t/\\") {
+			err = fmt.Errorf("the profile name \"%v\" should be a single word, other than %v", name, DefaultProfile)
+			return
+		}
+	}
+	if _, err = c.httpConfig().settings(); err != nil {
+		return
+	}
+	for name, text := range c.Templates {
+		if name == "" || strings.ContainsAny(name, " \t:") {
+			err = fmt.Errorf("the template name \"%v\" should be a single word", name)
+			return
+		}
+		// the fields are checked when the template is registered as a format
+		if _, err = template.New(name).Parse(text); err != nil {
+			err = fmt.Errorf("the %v template is invalid: %v", name, err)
+			return
+		}
+	}
 	ok = true
 	return
 }
@@ -222,17 +523,43 @@ func (c *Config) load(configFilename string) (ok bool, err error) {
 	json.Unmarshal(raw, c)
 	ok = true
 	c.Path = configFilename
+	c.fileSources(raw)
 	if configExists(configFilename) {
 		c.Loaded = true
 	}
 	return
 }
 
+// Save writes the config to the path, readable only by its owner since it can hold the token
+func (c Config) Save(path string) (err error) {
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	temp := path + ".tmp"
+	if err = ioutil.WriteFile(temp, append(data, '\n'), 0600); err != nil {
+		return
+	}
+	return os.Rename(temp, path)
+}
+
 func createFromConfig(configFilename string) (dropbox Config, err error) {
 	_, err = dropbox.load(configFilename)
 	return
 }
 
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func configExists(configFilename string) bool {
 	if _, err := os.Stat(configFilename); os.IsNotExist(err) {
 		return false
@@ -255,32 +582,79 @@ func (c Client) valid() bool {
 	return true
 }
 
-func (c Client) basicRequest(fullURL string, payload bytes.Buffer) (result *http.Response, err error) {
-	request, err := http.NewRequest(http.MethodPost, fullURL, &payload)
+// basicRequest posts the payload, refreshing the access token and trying again
+// when Dropbox says it has expired
+func (c Client) basicRequest(ctx context.Context, fullURL string, payload bytes.Buffer) (result *http.Response, err error) {
+	body := payload.Bytes()
+	token, err := c.accessToken(ctx)
 	if err != nil {
-		panic(err)
+		return
+	}
+	result, err = c.post(ctx, fullURL, body, token)
+	if err != nil || result.StatusCode != http.StatusUnauthorized || !c.LoggedIn() {
+		return
+	}
+	if err = apiError(result); !errors.Is(err, ErrTokenExpired) {
+		return nil, err
+	}
+	if err = c.tokens.refresh(ctx, c, token); err != nil {
+		return nil, err
+	}
+	if token, err = c.accessToken(ctx); err != nil {
+		return nil, err
+	}
+	return c.post(ctx, fullURL, body, token)
+}
+
+func (c Client) post(ctx context.Context, fullURL string, body []byte, token string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodPost, fullURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
 	}
-	request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", c.Config.Token()))
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %v", token))
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("User-Agent", "Dropbox Gif Linker")
-	return http.DefaultClient.Do(request)
+	return c.httpClient().Do(request.WithContext(ctx))
+}
+
+// httpClient returns the client's HTTP client, or one with the default settings
+func (c Client) httpClient() httpclient.Doer {
+	if c.HTTP == nil {
+		return httpclient.Default()
+	}
+	return c.HTTP
 }
 
 // CreateLink handles the filename and returns the Link object
 func (c Client) CreateLink(filename string) (link Link, err error) {
+	return c.CreateLinkContext(context.Background(), filename)
+}
+
+// CreateLinkContext is CreateLink, giving up when the context is done. An
+// existing link is reused, and made public if it isn't already.
+func (c Client) CreateLinkContext(ctx context.Context, filename string) (link Link, err error) {
 	filename, err = c.Truncate(filename)
 	if err != nil {
 		return
 	}
-	link, err = c.exists(filename)
+	link, err = c.exists(ctx, filename)
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "no existing link") {
-			err = nil
-			link, err = c.create(filename)
+		if !strings.HasPrefix(err.Error(), "no existing link") {
+			return
 		}
-		return
+		link, err = c.create(ctx, filename)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			return
+		}
+		// the link was made since looking for one, so use the one Dropbox sent back
+		var ok bool
+		if link, ok = apiErr.ExistingLink(); !ok {
+			return
+		}
+		link.GifsDir = c.Config.GifsPath()
 	}
-	return
+	return c.publish(ctx, link)
 }
 
 // Truncate removes the full dropbox path from the filename
@@ -293,48 +667,81 @@ func (c Client) Truncate(filename string) (truncated string, err error) {
 	return
 }
 
-func (c Client) exists(filename string) (link Link, err error) {
+func (c Client) exists(ctx context.Context, filename string) (link Link, err error) {
 	if !c.valid() {
 		err = errors.New("client is not valid")
 		return
 	}
 
 	filename = c.fixFilename(filename)
-	payload := c.existingPayload(filename)
+	found := false
+	err = c.ListSharedLinks(ctx, ListOptions{Path: filename, DirectOnly: true}, func(l Link) error {
+		if strings.ToLower(l.Path) == strings.ToLower(filename) {
+			link, found = l, true
+			return ErrStop
+		}
+		return nil
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("no existing link for %v", filename)
+	}
+	return
+}
+
+// ListSharedLinks calls fn with each shared link, a page at a time, until
+// there are no more or fn returns an error. Return ErrStop to stop early.
+func (c Client) ListSharedLinks(ctx context.Context, options ListOptions, fn func(Link) error) error {
+	if !c.valid() {
+		return errors.New("client is not valid")
+	}
+	cursor := ""
+	for {
+		page, err := c.listPage(ctx, options, cursor)
+		if err != nil {
+			return err
+		}
+		for _, l := range page.Links {
+			l.GifsDir = c.Config.GifsPath()
+			if err = fn(l); err == ErrStop {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		if !page.HasMore {
+			return nil
+		}
+		if page.Cursor == "" || page.Cursor == cursor {
+			return errors.New("dropbox has more shared links, but no cursor to list them")
+		}
+		cursor = page.Cursor
+	}
+}
+
+// listPage returns a page of shared links, starting from the cursor
+func (c Client) listPage(ctx context.Context, options ListOptions, cursor string) (page existsResponse, err error) {
+	payload := c.existingPayload(options, cursor)
 	fullURL := c.existingURL()
-	result, err := c.basicRequest(fullURL, payload)
+	result, err := c.basicRequest(ctx, fullURL, payload)
 
 	if err != nil {
 		return
 	}
 	if result.StatusCode != http.StatusOK {
-		err = fmt.Errorf("dropbox returned a %d", result.StatusCode)
+		err = apiError(result)
 		return
 	}
 
 	var rawBody []byte
-	var exists existsResponse
 	rawBody, err = ioutil.ReadAll(result.Body)
 	defer result.Body.Close()
 	if err == nil {
-		json.Unmarshal(rawBody, &exists)
-		if len(exists.Links) > 0 {
-			for _, l := range exists.Links {
-				if strings.ToLower(l.Path) == strings.ToLower(filename) {
-					link = l
-					link.GifsDir = c.Config.GifsPath()
-					return
-				}
-			}
-			err = fmt.Errorf("no existing link for %v", filename)
-		} else {
-			err = fmt.Errorf("no existing link for %v", filename)
-		}
+		err = json.Unmarshal(rawBody, &page)
 	}
 	return
 }
 
-func (c Client) create(filename string) (link Link, err error) {
+func (c Client) create(ctx context.Context, filename string) (link Link, err error) {
 	if !c.valid() {
 		err = errors.New("client is not valid")
 		return
@@ -343,13 +750,13 @@ func (c Client) create(filename string) (link Link, err error) {
 	filename = c.fixFilename(filename)
 	payload := c.creationPayload(filename)
 	fullURL := c.creationURL()
-	result, err := c.basicRequest(fullURL, payload)
+	result, err := c.basicRequest(ctx, fullURL, payload)
 
 	if err != nil {
 		return
 	}
 	if result.StatusCode != http.StatusOK {
-		err = fmt.Errorf("dropbox returned a %d", result.StatusCode)
+		err = apiError(result)
 		return
 	}
 
@@ -363,6 +770,40 @@ func (c Client) create(filename string) (link Link, err error) {
 	return
 }
 
+// publish makes an existing link public, leaving links that already are alone
+func (c Client) publish(ctx context.Context, link Link) (published Link, err error) {
+	if link.Public() {
+		return link, nil
+	}
+	payload := c.modificationPayload(link.URL)
+	fullURL := c.modificationURL()
+	result, err := c.basicRequest(ctx, fullURL, payload)
+
+	if err != nil {
+		return
+	}
+	if result.StatusCode != http.StatusOK {
+		err = apiError(result)
+		return
+	}
+
+	var rawBody []byte
+	rawBody, err = ioutil.ReadAll(result.Body)
+	defer result.Body.Close()
+	if err == nil {
+		json.Unmarshal(rawBody, &published)
+		published.GifsDir = c.Config.GifsPath()
+	}
+	return
+}
+
+// Public returns whether anyone with the link can see the file. Links that don't
+// say are assumed to be public.
+func (l Link) Public() bool {
+	visibility := l.Permissions.ResolvedVisibility.Tag
+	return visibility == "" || visibility == "public"
+}
+
 // DirectLink returns the embeddable string
 // From: https://www.dropbox.com/s/eqoo012hoa0wq7k/taylor%20bat%20focused.gif?dl=0
 // To:   https://dl.dropboxusercontent.com/s/eqoo012hoa0wq7k/taylor%20bat%20focused.gif
@@ -412,8 +853,8 @@ func (c Client) fixFilename(filename string) string {
 	return filename
 }
 
-func (c Client) existingPayload(filename string) (buf bytes.Buffer) {
-	payload := existingPayload{filename}
+func (c Client) existingPayload(options ListOptions, cursor string) (buf bytes.Buffer) {
+	payload := existingPayload{options.Path, cursor, options.DirectOnly}
 	err := json.NewEncoder(&buf).Encode(&payload)
 	if err != nil {
 		fmt.Printf("There was an error encoding the json. err = %s", err)
@@ -430,6 +871,15 @@ func (c Client) creationPayload(filename string) (buf bytes.Buffer) {
 	return
 }
 
+func (c Client) modificationPayload(url string) (buf bytes.Buffer) {
+	payload := modificationPayload{url, c.settingPayload()}
+	err := json.NewEncoder(&buf).Encode(&payload)
+	if err != nil {
+		fmt.Printf("There was an error encoding the json. err = %s", err)
+	}
+	return
+}
+
 func (c Client) settingPayload() settingPayload {
 	return settingPayload{"public"}
 }
@@ -446,6 +896,12 @@ func (c Client) existingURL() string {
 	return u.String()
 }
 
+func (c Client) modificationURL() string {
+	u := c.apiURL()
+	u.Path = c.modificationPath()
+	return u.String()
+}
+
 func (c Client) apiURL() *url.URL {
 	u, err := url.Parse(c.Host)
 	if err != nil {
@@ -461,3 +917,7 @@ func (c Client) creationPath() string {
 func (c Client) existingPath() string {
 	return fmt.Sprintf("%d/sharing/list_shared_links", c.Version)
 }
+
+func (c Client) modificationPath() string {
+	return fmt.Sprintf("%d/sharing/modify_shared_link_settings", c.Version)
+}
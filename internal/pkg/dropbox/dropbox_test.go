@@ -1,7 +1,12 @@
 package dropbox
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -9,15 +14,25 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/httpclient"
 )
 
 var validConfigFilename = fixturePath("valid")
 var invalidPathConfigFilename = fixturePath("invalid_path")
 var invalidDirConfigFilename = fixturePath("invalid_dir")
 var emptyConfigFilename = fixturePath("empty")
+var templatesConfigFilename = fixturePath("templates")
+var invalidTemplateConfigFilename = fixturePath("invalid_template")
+var jsonStorageConfigFilename = fixturePath("json_storage")
+var invalidStorageConfigFilename = fixturePath("invalid_storage")
+var syncConfigFilename = fixturePath("sync")
+var httpConfigFilename = fixturePath("http")
+var invalidHTTPConfigFilename = fixturePath("invalid_http")
 var missingConfigFilename = fixturePath("missing")
 
 type testConfig struct {
@@ -33,8 +48,8 @@ func (t testConfig) FullPath() string {
 func (t testConfig) GifsPath() string {
 	return t.gifDir
 }
-func (t testConfig) Token() string {
-	return t.apiToken
+func (t testConfig) Credentials() CredentialProvider {
+	return StaticToken(t.apiToken)
 }
 func (t testConfig) Valid() bool {
 	return t.valid
@@ -51,6 +66,45 @@ func (t testConfig) DatabasePath() string {
 func (t testConfig) LoadedPath() string {
 	return ""
 }
+func (t testConfig) OutputTemplates() map[string]string {
+	return nil
+}
+func (t testConfig) Storage() string {
+	return "bolt"
+}
+func (t testConfig) SyncEnabled() bool {
+	return false
+}
+func (t testConfig) SyncDir() string {
+	return ""
+}
+func (t testConfig) SyncStatePath() string {
+	return ""
+}
+func (t testConfig) SharedDatabasePath() string {
+	return t.DatabasePath()
+}
+func (t testConfig) MachineName() string {
+	return "test"
+}
+func (t testConfig) AppKey() string {
+	return ""
+}
+func (t testConfig) CredentialsPath() string {
+	return ""
+}
+func (t testConfig) Settings() []Setting {
+	return nil
+}
+func (t testConfig) Profile() string {
+	return ""
+}
+func (t testConfig) ProfileNames() []string {
+	return nil
+}
+func (t testConfig) HTTPSettings() httpclient.Settings {
+	return httpclient.Settings{Timeout: time.Second, Retries: 2}
+}
 
 var missingFile = "/gifs/def.gif"
 var existingFile = "/gifs/taylor swift/excited/file name 1.gif"
@@ -129,6 +183,77 @@ func TestConfigDatabasePath(t *testing.T) {
 	assert.Equal(dbPath, d.DatabasePath())
 }
 
+func TestConfigStorage(t *testing.T) {
+	d, _ := createFromConfig(validConfigFilename)
+	assert.Equal(t, "bolt", d.Storage())
+
+	d, _ = createFromConfig(jsonStorageConfigFilename)
+	assert.Equal(t, "json", d.Storage())
+	assert.Equal(t, filepath.Join(d.FullPath(), ".gifs", "gifs.json"), d.DatabasePath())
+
+	d, _ = createFromConfig(invalidStorageConfigFilename)
+	ok, err := d.validate()
+	assert.False(t, ok)
+	assert.NotNil(t, err)
+	assert.Equal(t, "the storage should be \"bolt\" or \"json\" instead of \"sqlite\"", err.Error())
+}
+
+func TestConfigSync(t *testing.T) {
+	d, _ := createFromConfig(validConfigFilename)
+	assert.False(t, d.SyncEnabled())
+	assert.Equal(t, d.SharedDatabasePath(), d.DatabasePath())
+	hostname, _ := os.Hostname()
+	assert.Equal(t, hostname, d.MachineName())
+
+	d, _ = createFromConfig(syncConfigFilename)
+	assert.True(t, d.SyncEnabled())
+	assert.Equal(t, "laptop", d.MachineName())
+	assert.Equal(t, filepath.Join(d.FullPath(), ".gifs", "sync"), d.SyncDir())
+	assert.Equal(t, filepath.Join(d.FullPath(), ".gifs", "gifs.bolt.db"), d.SharedDatabasePath())
+	assert.Equal(t, configPath(filepath.Join(".dgl", "gifs.bolt.db")), d.DatabasePath())
+	assert.Equal(t, configPath(filepath.Join(".dgl", "sync.json")), d.SyncStatePath())
+
+	// the development environment keeps its own database and sync files
+	d.Env = "development"
+	assert.Equal(t, filepath.Join(d.FullPath(), ".gifs", "sync-development"), d.SyncDir())
+	assert.Equal(t, filepath.Join(d.FullPath(), ".gifs", "gifs-development.bolt.db"), d.SharedDatabasePath())
+	assert.Equal(t, configPath(filepath.Join(".dgl", "gifs-development.bolt.db")), d.DatabasePath())
+	assert.Equal(t, configPath(filepath.Join(".dgl", "sync-development.json")), d.SyncStatePath())
+	d.Env = "test"
+	assert.Equal(t, "", d.DatabasePath())
+
+	d = Config{}
+	assert.False(t, d.SyncEnabled())
+	assert.Equal(t, "", d.SyncDir())
+	assert.Equal(t, "", d.SyncStatePath())
+	assert.Equal(t, "", d.SharedDatabasePath())
+}
+
+func TestConfigHTTPSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	d, _ := createFromConfig(validConfigFilename)
+	assert.Equal(httpclient.DefaultSettings, d.HTTPSettings())
+
+	d, _ = createFromConfig(httpConfigFilename)
+	settings := d.HTTPSettings()
+	assert.Equal(10*time.Second, settings.Timeout)
+	assert.Equal(0, settings.Retries)
+	assert.Equal(httpclient.DefaultSettings.Backoff, settings.Backoff)
+	assert.Equal(time.Minute, settings.MaxBackoff)
+
+	d, _ = createFromConfig(invalidHTTPConfigFilename)
+	ok, err := d.validate()
+	assert.False(ok)
+	assert.NotNil(err)
+	assert.Equal("the http timeout should be a duration like \"30s\" instead of \"ten seconds\"", err.Error())
+	assert.Equal(httpclient.DefaultSettings, d.HTTPSettings())
+
+	retries := -1
+	_, err = HTTPConfig{Retries: &retries}.settings()
+	assert.Equal("the http retries should be 0 or more instead of -1", err.Error())
+}
+
 func TestConfigLoadedPath(t *testing.T) {
 	// valid config
 	d := Config{}
@@ -137,6 +262,17 @@ func TestConfigLoadedPath(t *testing.T) {
 	assert.Equal(t, validConfigFilename, d.LoadedPath())
 }
 
+func TestConfigOutputTemplates(t *testing.T) {
+	d, _ := createFromConfig(templatesConfigFilename)
+	assert.Equal(t, map[string]string{"wiki": "[[File:{{.BaseName}}|link={{.URL}}]]", "forum": "[gif size={{.FileSize}}]{{.URL}}[/gif]"}, d.OutputTemplates())
+
+	d, _ = createFromConfig(validConfigFilename)
+	assert.Nil(t, d.OutputTemplates())
+
+	d, _ = createFromConfig(invalidTemplateConfigFilename)
+	assert.Nil(t, d.OutputTemplates())
+}
+
 func TestConfigGifDirFix(t *testing.T) {
 	d := Config{GifDir: "example/"}
 
@@ -176,6 +312,13 @@ func TestConfigValidate(t *testing.T) {
 	assert.True(ok)
 	assert.Nil(err)
 
+	d, derr = createFromConfig(invalidTemplateConfigFilename)
+	ok, err = d.validate()
+	assert.False(d.Valid())
+	assert.False(ok)
+	assert.NotNil(err)
+	assert.Equal("the broken template is invalid: template: broken:1: bad character U+007D '}'", err.Error())
+
 	d, derr = createFromConfig(emptyConfigFilename)
 	ok, err = d.validate()
 	assert.False(d.Valid())
@@ -227,38 +370,141 @@ func TestClientFixFilename(t *testing.T) {
 }
 
 func TestClientCreateLink(t *testing.T) {
-	c := newClient(validConfig)
-	apiStub := stubInvalidAuth()
-	c.Host = apiStub.URL
+	assert := assert.New(t)
+	localFile := filepath.Join(fullPath, "taylor swift/excited/file name 1.gif")
+	listed := craftExistingResponse(existingFile)
+	unlisted := "{\"links\": [], \"has_more\": false}"
+	created := craftCreationResponse(existingFile)
+	private := strings.Replace(created, "\"public\"", "\"team_only\"", 1)
+
+	tests := []struct {
+		name   string
+		routes map[string]stubRoute
+		err    string
+		calls  []string
+	}{
+		{
+			name:   "when it exists",
+			routes: map[string]stubRoute{"list_shared_links": {200, listed}},
+			calls:  []string{"list_shared_links"},
+		},
+		{
+			name: "when it does not exist and creation succeeds",
+			routes: map[string]stubRoute{
+				"list_shared_links":                {200, unlisted},
+				"create_shared_link_with_settings": {200, created},
+			},
+			calls: []string{"list_shared_links", "create_shared_link_with_settings"},
+		},
+		{
+			name: "when it does not exist and creation fails",
+			routes: map[string]stubRoute{
+				"list_shared_links":                {200, unlisted},
+				"create_shared_link_with_settings": {409, creationFailsResponse()},
+			},
+			err:   "dropbox returned a 409 (path/not_found)",
+			calls: []string{"list_shared_links", "create_shared_link_with_settings"},
+		},
+		{
+			name:   "when the dropbox api returns a 409 on exist check",
+			routes: map[string]stubRoute{"list_shared_links": {409, creationFailsResponse()}},
+			err:    "dropbox returned a 409 (path/not_found)",
+			calls:  []string{"list_shared_links"},
+		},
+		{
+			name: "when it was created since the exist check",
+			routes: map[string]stubRoute{
+				"list_shared_links":                {200, unlisted},
+				"create_shared_link_with_settings": {409, linkExistsResponse(created)},
+			},
+			calls: []string{"list_shared_links", "create_shared_link_with_settings"},
+		},
+		{
+			name: "when it was created since the exist check, without the link",
+			routes: map[string]stubRoute{
+				"list_shared_links":                {200, unlisted},
+				"create_shared_link_with_settings": {409, creationExistsResponse()},
+			},
+			err:   "dropbox returned a 409 (shared_link_already_exists)",
+			calls: []string{"list_shared_links", "create_shared_link_with_settings"},
+		},
+		{
+			name: "when it exists but is not public",
+			routes: map[string]stubRoute{
+				"list_shared_links":           {200, strings.Replace(listed, "\"public\"", "\"team_only\"", 1)},
+				"modify_shared_link_settings": {200, created},
+			},
+			calls: []string{"list_shared_links", "modify_shared_link_settings"},
+		},
+		{
+			name: "when it was created since the exist check and is not public",
+			routes: map[string]stubRoute{
+				"list_shared_links":                {200, unlisted},
+				"create_shared_link_with_settings": {409, linkExistsResponse(private)},
+				"modify_shared_link_settings":      {200, created},
+			},
+			calls: []string{"list_shared_links", "create_shared_link_with_settings", "modify_shared_link_settings"},
+		},
+		{
+			name: "when it cannot be made public",
+			routes: map[string]stubRoute{
+				"list_shared_links":           {200, strings.Replace(listed, "\"public\"", "\"team_only\"", 1)},
+				"modify_shared_link_settings": {409, `{"error_summary": "settings_error/not_authorized/..", "error": {".tag": "settings_error", "settings_error": {".tag": "not_authorized"}}}`},
+			},
+			err:   "dropbox returned a 409 (settings_error/not_authorized)",
+			calls: []string{"list_shared_links", "modify_shared_link_settings"},
+		},
+	}
+	for _, test := range tests {
+		c := newClient(validConfig)
+		apiStub, calls := stubAPI(test.routes)
+		c.Host = apiStub.URL
+		link, err := c.CreateLink(localFile)
+		if test.err != "" {
+			assert.NotNil(err, test.name)
+			if err != nil {
+				assert.Equal(test.err, err.Error(), test.name)
+			}
+		} else {
+			assert.Nil(err, test.name)
+			assert.True(link.Public(), test.name)
+			assert.Equal("https://dl.dropboxusercontent.com/s/DROPBOX_HASH/file+name+1.gif", link.DirectLink(), test.name)
+			assert.Equal("/taylor swift/excited", link.Directory(), test.name)
+		}
+		assert.Equal(test.calls, *calls, test.name)
+		apiStub.Close()
+	}
+}
 
-	// TODO: write some tests!
-	// 1. when it exists
-	// 2. when it does not exist and creation succeeds
-	// 3. when it does not exist and creation fails
-	// 4. when the dropbox api returns a 409 on exist check
+func TestLinkPublic(t *testing.T) {
+	assert.True(t, Link{}.Public())
+	link := Link{Permissions: LinkPermissions{ResolvedVisibility: LinkTag{"public"}}}
+	assert.True(t, link.Public())
+	link.Permissions.ResolvedVisibility.Tag = "password"
+	assert.False(t, link.Public())
 }
 
 func TestClientCreationWithInvalidAuthServer(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubInvalidAuth()
 	c.Host = apiStub.URL
-	_, err := c.create(missingFile)
-	assert.Equal(t, "dropbox returned a 400", err.Error())
+	_, err := c.create(context.Background(), missingFile)
+	assert.Equal(t, "dropbox returned a 400 (Error in call to API function \"/2/sharing/create_shared_link_with_settings\": The given OAuth 2 access token is malformed.)", err.Error())
 }
 
 func TestClientExistsWithInvalidAuthServer(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubInvalidAuth()
 	c.Host = apiStub.URL
-	_, err := c.exists(missingFile)
-	assert.Equal(t, "dropbox returned a 400", err.Error())
+	_, err := c.exists(context.Background(), missingFile)
+	assert.Equal(t, "dropbox returned a 400 (Error in call to API function \"/2/sharing/list_shared_links\": The given OAuth 2 access token is malformed.)", err.Error())
 }
 
 func TestClientCreationSuccess(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubCreationSuccess(existingFile)
 	c.Host = apiStub.URL
-	url, err := c.create(existingFile)
+	url, err := c.create(context.Background(), existingFile)
 	assert.Nil(t, err)
 	assert.Equal(t, "https://dl.dropboxusercontent.com/s/DROPBOX_HASH/file+name+1.gif", url.DirectLink())
 	assert.Equal(t, fmt.Sprintf("![%v](%v)", url.Name, "https://dl.dropboxusercontent.com/s/DROPBOX_HASH/file+name+1.gif"), url.Markdown())
@@ -271,23 +517,104 @@ func TestClientCreationExists(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubCreationExists()
 	c.Host = apiStub.URL
-	_, err := c.create(existingFile)
-	assert.Equal(t, "dropbox returned a 409", err.Error())
+	_, err := c.create(context.Background(), existingFile)
+	assert.Equal(t, "dropbox returned a 409 (shared_link_already_exists)", err.Error())
+	assert.True(t, errors.Is(err, ErrLinkExists))
 }
 
 func TestClientCreationFailure(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubCreationFailure()
 	c.Host = apiStub.URL
-	_, err := c.create(missingFile)
-	assert.Equal(t, "dropbox returned a 409", err.Error())
+	_, err := c.create(context.Background(), missingFile)
+	assert.Equal(t, "dropbox returned a 409 (path/not_found)", err.Error())
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestClientCreationRetries(t *testing.T) {
+	c := newClient(validConfig)
+	apiStub := stubUnavailable(1, stubCreationSuccess(existingFile))
+	c.Host = apiStub.URL
+	link, err := c.create(context.Background(), existingFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "DROPBOX_ID", link.DropboxID())
+}
+
+func TestClientCreationGivesUp(t *testing.T) {
+	c := newClient(validConfig)
+	apiStub := stubUnavailable(5, stubCreationSuccess(existingFile))
+	c.Host = apiStub.URL
+	_, err := c.create(context.Background(), existingFile)
+	assert.Equal(t, "dropbox returned a 429", err.Error())
+	assert.True(t, errors.Is(err, ErrRateLimited))
+}
+
+func TestClientCreationCanceled(t *testing.T) {
+	c := newClient(validConfig)
+	apiStub := stubCreationSuccess(existingFile)
+	c.Host = apiStub.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.CreateLinkContext(ctx, filepath.Join(fullPath, existingFile))
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestClientBadRequestURL(t *testing.T) {
+	c := newClient(validConfig)
+	assert.NotPanics(t, func() {
+		_, err := c.basicRequest(context.Background(), "http://bad host/", bytes.Buffer{})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestClientExistsWithExpiredToken(t *testing.T) {
+	c := newClient(validConfig)
+	apiStub := stubStatus(http.StatusUnauthorized, expiredTokenResponse())
+	c.Host = apiStub.URL
+	_, err := c.exists(context.Background(), existingFile)
+	assert.Equal(t, "dropbox returned a 401 (expired_access_token)", err.Error())
+	assert.True(t, errors.Is(err, ErrTokenExpired))
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "expired_access_token", apiErr.Tag)
+}
+
+func TestAPIError(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		status  int
+		body    string
+		message string
+		tag     string
+		kind    error
+	}{
+		{409, creationExistsResponse(), "dropbox returned a 409 (shared_link_already_exists)", "shared_link_already_exists", ErrLinkExists},
+		{409, creationFailsResponse(), "dropbox returned a 409 (path/not_found)", "path/not_found", ErrNotFound},
+		{400, `{"error_summary": "email_not_verified/..", "error": {".tag": "email_not_verified"}}`, "dropbox returned a 400 (email_not_verified)", "email_not_verified", ErrEmailNotVerified},
+		{401, expiredTokenResponse(), "dropbox returned a 401 (expired_access_token)", "expired_access_token", ErrTokenExpired},
+		{401, `{"error_summary": "invalid_access_token/.", "error": {".tag": "invalid_access_token"}}`, "dropbox returned a 401 (invalid_access_token)", "invalid_access_token", ErrInvalidToken},
+		{429, `{"error_summary": "too_many_requests/..", "error": {"reason": {".tag": "too_many_requests"}}}`, "dropbox returned a 429 (too_many_requests)", "", ErrRateLimited},
+		{409, `{"error_summary": "path/malformed_path/.", "error": {".tag": "path", "path": {".tag": "malformed_path"}}}`, "dropbox returned a 409 (path/malformed_path)", "path/malformed_path", nil},
+		{500, "<html>\n<body>oops</body>\n</html>", "dropbox returned a 500 (<html>)", "", nil},
+		{503, "", "dropbox returned a 503", "", nil},
+	}
+	for _, test := range tests {
+		result := &http.Response{StatusCode: test.status, Body: ioutil.NopCloser(strings.NewReader(test.body))}
+		err := apiError(result)
+		assert.Equal(test.message, err.Error())
+		assert.Equal(test.tag, err.(*APIError).Tag, test.message)
+		assert.Equal(test.kind, errors.Unwrap(err), test.message)
+	}
 }
 
 func TestClientExistsWithNoLinks(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubUnshared()
 	c.Host = apiStub.URL
-	_, err := c.exists(missingFile)
+	_, err := c.exists(context.Background(), missingFile)
 	assert.Equal(t, fmt.Sprintf("no existing link for %v", missingFile), err.Error())
 }
 
@@ -295,7 +622,7 @@ func TestClientExistsWithLinks(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubShared(existingFile)
 	c.Host = apiStub.URL
-	url, err := c.exists(existingFile)
+	url, err := c.exists(context.Background(), existingFile)
 	assert.Nil(t, err)
 	assert.Equal(t, "https://dl.dropboxusercontent.com/s/DROPBOX_HASH/file+name+1.gif", url.DirectLink())
 }
@@ -304,7 +631,7 @@ func TestClientExistsWithMultipleLinks(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubSharedMultiple(existingFile)
 	c.Host = apiStub.URL
-	url, err := c.exists(existingFile)
+	url, err := c.exists(context.Background(), existingFile)
 	assert.Nil(t, err)
 	assert.Equal(t, "https://dl.dropboxusercontent.com/s/DROPBOX_HASH/file+name+1.gif", url.DirectLink())
 }
@@ -313,14 +640,75 @@ func TestClientExistsWithMultipleLinksNoMatch(t *testing.T) {
 	c := newClient(validConfig)
 	apiStub := stubSharedMultipleNoMatch()
 	c.Host = apiStub.URL
-	_, err := c.exists(missingFile)
+	_, err := c.exists(context.Background(), missingFile)
 	assert.Equal(t, fmt.Sprintf("no existing link for %v", missingFile), err.Error())
 }
 
+func TestClientExistsOnLaterPage(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient(validConfig)
+	apiStub, payloads := stubPages(existingResponseMultipleNoMatch(), craftExistingResponse(existingFile))
+	c.Host = apiStub.URL
+	link, err := c.exists(context.Background(), existingFile)
+	assert.Nil(err)
+	assert.Equal("https://dl.dropboxusercontent.com/s/DROPBOX_HASH/file+name+1.gif", link.DirectLink())
+	assert.Equal(gifDir, link.GifsDir)
+	assert.Len(*payloads, 2)
+	assert.Equal(existingPayload{existingFile, "", true}, (*payloads)[0])
+	assert.Equal(existingPayload{existingFile, "CURSOR-1", true}, (*payloads)[1])
+}
+
+func TestClientListSharedLinks(t *testing.T) {
+	assert := assert.New(t)
+	c := newClient(validConfig)
+	apiStub, payloads := stubPages(existingResponseMultipleNoMatch(), craftExistingResponse(existingFile), existingResponseMultipleNoMatch())
+	c.Host = apiStub.URL
+
+	var ids []string
+	err := c.ListSharedLinks(context.Background(), ListOptions{}, func(l Link) error {
+		ids = append(ids, l.DropboxID())
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal([]string{"DROPBOX_ID_OTHER", "DROPBOX_ID_OTHER", "DROPBOX_ID", "DROPBOX_ID_OTHER", "DROPBOX_ID_OTHER"}, ids)
+	assert.Len(*payloads, 3)
+	assert.Equal(existingPayload{"", "CURSOR-2", false}, (*payloads)[2])
+
+	// stopping early
+	apiStub, payloads = stubPages(existingResponseMultipleNoMatch(), craftExistingResponse(existingFile))
+	c.Host = apiStub.URL
+	count := 0
+	err = c.ListSharedLinks(context.Background(), ListOptions{}, func(l Link) error {
+		count++
+		return ErrStop
+	})
+	assert.Nil(err)
+	assert.Equal(1, count)
+	assert.Len(*payloads, 1)
+
+	// failing
+	failure := errors.New("failure")
+	err = c.ListSharedLinks(context.Background(), ListOptions{}, func(l Link) error {
+		return failure
+	})
+	assert.Equal(failure, err)
+
+	// more, without a cursor
+	apiStub = stubStatus(http.StatusOK, strings.Replace(craftExistingResponse(existingFile), "\"has_more\": false", "\"has_more\": true", 1))
+	c.Host = apiStub.URL
+	err = c.ListSharedLinks(context.Background(), ListOptions{}, func(l Link) error { return nil })
+	assert.Equal("dropbox has more shared links, but no cursor to list them", err.Error())
+
+	// invalid client
+	err = newClient(invalidConfig).ListSharedLinks(context.Background(), ListOptions{}, func(l Link) error { return nil })
+	assert.Equal("client is not valid", err.Error())
+}
+
 func TestNewClient(t *testing.T) {
 	c := newClient(validConfig)
 	assert.Equal(t, "https://api.dropboxapi.com", c.Host)
 	assert.Equal(t, 2, c.Version)
+	assert.NotNil(t, c.HTTP)
 }
 
 func TestClientValidClient(t *testing.T) {
@@ -339,9 +727,16 @@ func TestClientValidClient(t *testing.T) {
 }
 
 func TestClientExistingPayload(t *testing.T) {
-	data := client.existingPayload(missingFile)
+	data := client.existingPayload(ListOptions{Path: missingFile}, "")
 	json := fmt.Sprintf("{\"path\":\"%v\"}\n", missingFile)
 	assert.Equal(t, json, data.String())
+
+	data = client.existingPayload(ListOptions{Path: missingFile, DirectOnly: true}, "CURSOR")
+	json = fmt.Sprintf("{\"path\":\"%v\",\"cursor\":\"CURSOR\",\"direct_only\":true}\n", missingFile)
+	assert.Equal(t, json, data.String())
+
+	data = client.existingPayload(ListOptions{}, "")
+	assert.Equal(t, "{}\n", data.String())
 }
 
 func TestClientCreationPayload(t *testing.T) {
@@ -380,6 +775,78 @@ func stubInvalidAuth() *httptest.Server {
 	}))
 }
 
+// stubUnavailable asks the client to retry the first requests, then hands the
+// rest to the server
+func stubUnavailable(times int, server *httptest.Server) *httptest.Server {
+	var mutex sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if times > 0 {
+			times--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+}
+
+type stubRoute struct {
+	status int
+	body   string
+}
+
+// stubAPI answers each endpoint with its route, recording the endpoints called
+func stubAPI(routes map[string]stubRoute) (*httptest.Server, *[]string) {
+	var mutex sync.Mutex
+	calls := &[]string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		endpoint := path.Base(r.URL.Path)
+		*calls = append(*calls, endpoint)
+		route, ok := routes[endpoint]
+		if !ok {
+			route = stubRoute{http.StatusNotFound, "unknown endpoint"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(route.status)
+		w.Write([]byte(route.body))
+	})), calls
+}
+
+// stubPages answers with each page of links in turn, linking them with cursors,
+// and records the payloads sent
+func stubPages(pages ...string) (*httptest.Server, *[]existingPayload) {
+	var mutex sync.Mutex
+	payloads := &[]existingPayload{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		var payload existingPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		*payloads = append(*payloads, payload)
+		page := pages[0]
+		if len(pages) > 1 {
+			pages = pages[1:]
+			cursor := fmt.Sprintf("\"has_more\": true, \"cursor\": \"CURSOR-%d\"", len(*payloads))
+			page = strings.Replace(page, "\"has_more\": false", cursor, 1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(page))
+	})), payloads
+}
+
+// stubStatus answers every request with the status and body
+func stubStatus(status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
 func stubUnshared() *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -606,6 +1073,46 @@ func creationExistsResponse() string {
 	`
 }
 
+// returns a 409 - Conflict, with the existing link
+func linkExistsResponse(metadata string) string {
+	return fmt.Sprintf(`
+	{
+		"error_summary": "shared_link_already_exists/metadata/..",
+		"error": {
+			".tag": "shared_link_already_exists",
+			"shared_link_already_exists": {
+				".tag": "metadata",
+				"metadata": %v
+			}
+		}
+	}
+	`, metadata)
+}
+
+// returns a 401 - Unauthorized
+func expiredTokenResponse() string {
+	return `
+	{
+		"error_summary": "expired_access_token/..",
+		"error": {
+			".tag": "expired_access_token"
+		}
+	}
+	`
+}
+
+// returns a 401 - Unauthorized
+func invalidTokenResponse() string {
+	return `
+	{
+		"error_summary": "invalid_access_token/..",
+		"error": {
+			".tag": "invalid_access_token"
+		}
+	}
+	`
+}
+
 // returns a 409 - Conflict
 func creationFailsResponse() string {
 	return `
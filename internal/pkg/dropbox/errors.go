@@ -0,0 +1,125 @@
+package dropbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// The kinds of errors the Dropbox API answers with, to check for with errors.Is
+var (
+	ErrLinkExists       = errors.New("a shared link already exists")
+	ErrNotFound         = errors.New("the file was not found")
+	ErrEmailNotVerified = errors.New("the account's email address is not verified")
+	ErrTokenExpired     = errors.New("the access token has expired")
+	ErrInvalidToken     = errors.New("the access token is invalid")
+	ErrRateLimited      = errors.New("too many requests")
+)
+
+// APIError is an error answered by the Dropbox API
+type APIError struct {
+	StatusCode int
+	// Summary is the error_summary, without its trailing padding
+	Summary string
+	// Tag is the path through the nested .tag values, like "path/not_found"
+	Tag string
+	// Message is the body of an answer that isn't JSON, like a malformed token's
+	Message string
+	// details is the error itself, for anything Dropbox sent along with it
+	details json.RawMessage
+}
+
+// Error returns the status and whatever Dropbox said about it
+func (e *APIError) Error() string {
+	switch {
+	case e.Summary != "":
+		return fmt.Sprintf("dropbox returned a %d (%v)", e.StatusCode, e.Summary)
+	case e.Message != "":
+		return fmt.Sprintf("dropbox returned a %d (%v)", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("dropbox returned a %d", e.StatusCode)
+}
+
+// Unwrap returns the kind of error, if it is one of the known kinds
+func (e *APIError) Unwrap() error {
+	tags := strings.Split(e.Tag, "/")
+	for _, tag := range tags {
+		switch tag {
+		case "shared_link_already_exists":
+			return ErrLinkExists
+		case "not_found":
+			return ErrNotFound
+		case "email_not_verified":
+			return ErrEmailNotVerified
+		case "expired_access_token":
+			return ErrTokenExpired
+		case "invalid_access_token":
+			return ErrInvalidToken
+		case "too_many_requests", "too_many_write_operations":
+			return ErrRateLimited
+		}
+	}
+	if e.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// apiError reads the error from an answer that wasn't OK, and closes its body
+func apiError(result *http.Response) error {
+	defer result.Body.Close()
+	e := &APIError{StatusCode: result.StatusCode}
+	body, err := ioutil.ReadAll(io.LimitReader(result.Body, 64*1024))
+	if err != nil {
+		return e
+	}
+	var answer struct {
+		Summary string          `json:"error_summary"`
+		Error   json.RawMessage `json:"error"`
+	}
+	var union map[string]interface{}
+	if json.Unmarshal(body, &answer) != nil || (answer.Summary == "" && answer.Error == nil) {
+		e.Message = strings.SplitN(strings.TrimSpace(string(body)), "\n", 2)[0]
+		return e
+	}
+	json.Unmarshal(answer.Error, &union)
+	e.Summary = strings.TrimRight(answer.Summary, "/.")
+	e.Tag = strings.Join(tags(union), "/")
+	e.details = answer.Error
+	return e
+}
+
+// ExistingLink returns the link Dropbox sent back when asked to create one
+// that already exists, when it sent one
+func (e *APIError) ExistingLink() (link Link, ok bool) {
+	if !errors.Is(e, ErrLinkExists) {
+		return
+	}
+	var details struct {
+		Exists struct {
+			Metadata *Link `json:"metadata"`
+		} `json:"shared_link_already_exists"`
+	}
+	if json.Unmarshal(e.details, &details) != nil || details.Exists.Metadata == nil {
+		return
+	}
+	return *details.Exists.Metadata, true
+}
+
+// tags follows the .tag values down through the union, where each is the key
+// of the next, more specific one
+func tags(union map[string]interface{}) (path []string) {
+	for union != nil {
+		tag, ok := union[".tag"].(string)
+		if !ok {
+			return
+		}
+		path = append(path, tag)
+		union, _ = union[tag].(map[string]interface{})
+	}
+	return
+}
@@ -0,0 +1,130 @@
+package dropbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ProfileEnv is the environment variable naming the profile to use
+const ProfileEnv = "DGL_PROFILE"
+
+// DefaultProfile names the settings at the top of the config, to switch back to them
+const DefaultProfile = "default"
+
+// profileOverride is the profile given on the command line, if any
+var profileOverride string
+
+// SetProfile uses the named profile, instead of the one the config or environment names.
+// An empty name goes back to them.
+func SetProfile(name string) {
+	profileOverride = name
+}
+
+// Profile returns the name of the profile in use, or nothing for the settings
+// at the top of the config
+func (c Config) Profile() string {
+	return c.profile
+}
+
+// ProfileNames returns the names of the profiles in the config
+func (c Config) ProfileNames() (names []string) {
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// selectProfile picks the profile to use: the --profile flag, $DGL_PROFILE, then
+// the config's own profile
+func (c *Config) selectProfile() (name string, source string) {
+	switch {
+	case profileOverride != "":
+		return profileOverride, "--profile"
+	case os.Getenv(ProfileEnv) != "":
+		return os.Getenv(ProfileEnv), "$" + ProfileEnv
+	case c.DefaultProfile != "":
+		return c.DefaultProfile, c.Path
+	}
+	return "", ""
+}
+
+// useProfile lays the named profile's settings over the ones at the top of the config
+func (c *Config) useProfile(name string, source string) error {
+	if name == "" || name == DefaultProfile {
+		return nil
+	}
+	raw, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return fmt.Errorf("there is no %v profile, since the config has no profiles", name)
+		}
+		return fmt.Errorf("there is no %v profile (try %v)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	// the profile's settings are read over copies, so they don't change the originals
+	if c.HTTP != nil {
+		h := *c.HTTP
+		if h.Retries != nil {
+			retries := *h.Retries
+			h.Retries = &retries
+		}
+		c.HTTP = &h
+	}
+	if c.Templates != nil {
+		templates := map[string]string{}
+		for k, v := range c.Templates {
+			templates[k] = v
+		}
+		c.Templates = templates
+	}
+	// credentials are taken whole from the profile when it has any, so it can't
+	// end up using the token of another account
+	profileKeys := keys(raw)
+	for _, key := range profileKeys {
+		if credentialKeys[key] {
+			c.clearCredentials()
+			break
+		}
+	}
+	profiles, defaultName := c.Profiles, c.DefaultProfile
+	if err := json.Unmarshal(raw, c); err != nil {
+		return fmt.Errorf("the %v profile is invalid: %v", name, err)
+	}
+	c.Profiles, c.DefaultProfile = profiles, defaultName
+	c.profile = name
+	c.source("profile", source)
+	for _, key := range profileKeys {
+		c.source(key, fmt.Sprintf("%v (%v profile)", c.Path, name))
+	}
+	return nil
+}
+
+// credentialKeys are the settings that say which account to use
+var credentialKeys = map[string]bool{
+	"dropbox_api_token": true,
+	"token_env":         true,
+	"token_command":     true,
+	"token_file":        true,
+	"app_key":           true,
+}
+
+// clearCredentials drops the credentials from the top of the config, for a
+// profile with its own
+func (c *Config) clearCredentials() {
+	c.APIToken, c.TokenEnv, c.TokenCmd, c.TokenFile, c.App = "", "", "", "", ""
+	for key := range credentialKeys {
+		delete(c.sources, key)
+	}
+	c.profileCredentials = true
+}
+
+// profileSuffix sets the files of a profile apart from the default ones
+func (c Config) profileSuffix() string {
+	if c.profile == "" {
+		return ""
+	}
+	return "-" + c.profile
+}
@@ -0,0 +1,142 @@
+package dropbox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var profilesConfigFilename = fixturePath("profiles")
+
+func loadProfile(t *testing.T, name string) (Config, error) {
+	SetConfigPath(profilesConfigFilename)
+	SetProfile(name)
+	t.Cleanup(func() {
+		SetConfigPath("")
+		SetProfile("")
+	})
+	return NewConfig()
+}
+
+func TestConfigProfiles(t *testing.T) {
+	assert := assert.New(t)
+	setenv(t, ProfileEnv, "")
+
+	d, err := loadProfile(t, "")
+	assert.Nil(err)
+	assert.Equal("", d.Profile())
+	assert.Equal([]string{"reactions", "team", "work"}, d.ProfileNames())
+	assert.Equal("/gifs", d.GifsPath())
+	assert.True(strings.HasSuffix(d.DatabasePath(), filepath.Join(".gifs", "gifs.bolt.db")))
+	assert.True(strings.HasSuffix(d.CredentialsPath(), "credentials.json"))
+	assert.Equal(filepath.Join(filepath.Dir(d.DatabasePath()), "sync.json"), d.SyncStatePath())
+
+	d, err = loadProfile(t, "work")
+	assert.Nil(err)
+	assert.Equal("work", d.Profile())
+	assert.Equal("~/Dropbox (Company)", d.DropboxPath)
+	assert.Equal("/team gifs", d.GifsPath())
+	assert.Equal("WORK_APP_KEY", d.AppKey())
+	assert.Equal("", d.Token())
+	assert.Equal(10, int(d.HTTPSettings().Timeout.Seconds()))
+	assert.Equal(1, d.HTTPSettings().Retries)
+	assert.Equal(map[string]string{"wiki": "[[File:{{.BaseName}}]]", "jira": "!{{.URL}}!"}, d.OutputTemplates())
+
+	// each profile keeps its own database, sync logs, and credentials
+	assert.True(strings.HasSuffix(d.DatabasePath(), filepath.Join("Dropbox (Company)", "team gifs", ".gifs", "gifs-work.bolt.db")))
+	assert.True(strings.HasSuffix(d.SyncDir(), filepath.Join(".gifs", "sync-work")))
+	assert.Equal(filepath.Join(filepath.Dir(d.DatabasePath()), "sync-work.json"), d.SyncStatePath())
+	assert.True(strings.HasSuffix(d.CredentialsPath(), "credentials-work.json"))
+	assert.True(strings.HasSuffix(d.TokenFilePath(), "token-work.enc"))
+
+	byKey := settingsByKey(d)
+	assert.Equal(Setting{"profile", "work", "--profile"}, byKey["profile"])
+	assert.Equal(Setting{"dropbox_gif_dir", "/team gifs", profilesConfigFilename + " (work profile)"}, byKey["dropbox_gif_dir"])
+	assert.Equal(Setting{"http.timeout", "10s", profilesConfigFilename}, byKey["http.timeout"])
+
+	// the profile named by the environment is used unless the flag names another
+	SetProfile("")
+	setenv(t, ProfileEnv, "reactions")
+	d, err = NewConfig()
+	assert.Nil(err)
+	assert.Equal("reactions", d.Profile())
+	assert.Equal("~/Dropbox", d.DropboxPath)
+	assert.Equal("/reactions", d.GifsPath())
+	assert.Equal(Setting{"profile", "reactions", "$DGL_PROFILE"}, settingsByKey(d)["profile"])
+
+	d, err = loadProfile(t, "default")
+	assert.Nil(err)
+	assert.Equal("", d.Profile())
+	assert.Equal("/gifs", d.GifsPath())
+
+	// environment variables override the profile too
+	setenv(t, "DGL_DROPBOX_GIF_DIR", "/override")
+	d, err = loadProfile(t, "work")
+	assert.Nil(err)
+	assert.Equal("/override", d.GifsPath())
+
+	_, err = loadProfile(t, "play")
+	assert.Equal("there is no play profile (try reactions, team, work)", err.Error())
+}
+
+func TestConfigProfileCredentials(t *testing.T) {
+	assert := assert.New(t)
+	setenv(t, ProfileEnv, "")
+	setenv(t, DefaultTokenEnv, "")
+	os.Unsetenv(DefaultTokenEnv)
+
+	// a profile with credentials of its own inherits none from the top of the config
+	d, err := loadProfile(t, "team")
+	assert.Nil(err)
+	assert.Equal(MaskToken("TEAM_TOKEN"), d.Credentials().String())
+	token, err := d.Credentials().Token()
+	assert.Nil(err)
+	assert.Equal("TEAM_TOKEN", token)
+	assert.Equal("", d.TokenCmd)
+	assert.Equal(Setting{"token_command", "", "default"}, settingsByKey(d)["token_command"])
+
+	d, err = loadProfile(t, "work")
+	assert.Nil(err)
+	assert.Equal("", d.TokenCmd)
+	assert.Equal("WORK_APP_KEY", d.AppKey())
+
+	// a profile without credentials uses the ones at the top
+	d, err = loadProfile(t, "reactions")
+	assert.Nil(err)
+	assert.Equal("token_command", d.Credentials().String())
+	token, _ = d.Credentials().Token()
+	assert.Equal("PERSONAL_COMMAND_TOKEN", token)
+
+	// and so does DGL_API_TOKEN, which doesn't replace a profile's own
+	os.Setenv(DefaultTokenEnv, "FROM_ENV_TOKEN")
+	d, _ = loadProfile(t, "reactions")
+	token, _ = d.Credentials().Token()
+	assert.Equal("FROM_ENV_TOKEN", token)
+	d, _ = loadProfile(t, "team")
+	token, _ = d.Credentials().Token()
+	assert.Equal("TEAM_TOKEN", token)
+}
+
+func TestConfigDefaultProfile(t *testing.T) {
+	assert := assert.New(t)
+	setenv(t, ProfileEnv, "")
+
+	d, _ := createFromConfig(profilesConfigFilename)
+	d.DefaultProfile = "work"
+	name, source := d.selectProfile()
+	assert.Equal("work", name)
+	assert.Equal(profilesConfigFilename, source)
+
+	d = Config{}
+	name, _ = d.selectProfile()
+	assert.Equal("", name)
+	assert.Equal("there is no work profile, since the config has no profiles", d.useProfile("work", "--profile").Error())
+
+	d, _ = createFromConfig(profilesConfigFilename)
+	d.Profiles["default"] = nil
+	_, err := d.validate()
+	assert.Equal("the profile name \"default\" should be a single word, other than default", err.Error())
+}
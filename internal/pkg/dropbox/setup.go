@@ -0,0 +1,173 @@
+package dropbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Folder is a Dropbox folder found on this machine
+type Folder struct {
+	// Account is "personal" or "business", from Dropbox's own info.json, or
+	// empty for a folder found where Dropbox usually puts it
+	Account string
+	Path    string
+}
+
+// String returns the path, with the account it's for when known
+func (f Folder) String() string {
+	if f.Account == "" {
+		return f.Path
+	}
+	return fmt.Sprintf("%v (%v)", f.Path, f.Account)
+}
+
+// DetectFolders returns the Dropbox folders on this machine, reading where
+// Dropbox keeps them from its info.json, then looking where it usually does.
+// The paths are relative to the home directory when they can be.
+func DetectFolders() []Folder {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil
+	}
+	return detectFolders(home, infoFiles(home))
+}
+
+// infoFiles returns where Dropbox keeps its info.json on this platform
+func infoFiles(home string) (paths []string) {
+	if runtime.GOOS == "windows" {
+		for _, env := range []string{"APPDATA", "LOCALAPPDATA"} {
+			if dir := os.Getenv(env); dir != "" {
+				paths = append(paths, filepath.Join(dir, "Dropbox", "info.json"))
+			}
+		}
+		return
+	}
+	return []string{filepath.Join(home, ".dropbox", "info.json")}
+}
+
+func detectFolders(home string, infoFiles []string) (folders []Folder) {
+	seen := map[string]bool{}
+	add := func(account string, path string) {
+		if path == "" || seen[path] {
+			return
+		}
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			return
+		}
+		seen[path] = true
+		folders = append(folders, Folder{account, homePath(home, path)})
+	}
+	for _, infoFile := range infoFiles {
+		raw, err := ioutil.ReadFile(infoFile)
+		if err != nil {
+			continue
+		}
+		var info map[string]struct {
+			Path string `json:"path"`
+		}
+		if json.Unmarshal(raw, &info) != nil {
+			continue
+		}
+		for _, account := range []string{"personal", "business"} {
+			add(account, info[account].Path)
+		}
+	}
+	add("", filepath.Join(home, "Dropbox"))
+	add("", filepath.Join(home, "Library", "CloudStorage", "Dropbox"))
+	return
+}
+
+// homePath returns the path starting with ~/ when it's in the home directory
+func homePath(home string, path string) string {
+	if relative, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(relative, "..") && relative != "." {
+		return "~/" + filepath.ToSlash(relative)
+	}
+	return path
+}
+
+// GifDirs returns the folders at the top of the Dropbox folder with "gif" in
+// their names, ready for dropbox_gif_dir
+func GifDirs(dropboxPath string) (dirs []string) {
+	path, err := homedir.Expand(dropboxPath)
+	if err != nil {
+		return
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.Contains(strings.ToLower(entry.Name()), "gif") {
+			dirs = append(dirs, "/"+entry.Name())
+		}
+	}
+	sort.Strings(dirs)
+	return
+}
+
+// Account is the Dropbox account the token belongs to
+type Account struct {
+	ID    string      `json:"account_id"`
+	Email string      `json:"email"`
+	Name  AccountName `json:"name"`
+}
+
+// AccountName is what the account's owner is called
+type AccountName struct {
+	DisplayName string `json:"display_name"`
+}
+
+// String returns the owner's name and email address
+func (a Account) String() string {
+	return fmt.Sprintf("%v (%v)", a.Name.DisplayName, a.Email)
+}
+
+// CurrentAccount returns the account the token belongs to, which also checks
+// that the token works
+func (c Client) CurrentAccount(ctx context.Context) (account Account, err error) {
+	if !c.valid() {
+		err = errors.New("client is not valid")
+		return
+	}
+	var payload bytes.Buffer
+	payload.WriteString("null")
+	result, err := c.basicRequest(ctx, c.accountURL(), payload)
+
+	if err != nil {
+		return
+	}
+	if result.StatusCode != http.StatusOK {
+		err = apiError(result)
+		return
+	}
+
+	var rawBody []byte
+	rawBody, err = ioutil.ReadAll(result.Body)
+	defer result.Body.Close()
+	if err == nil {
+		err = json.Unmarshal(rawBody, &account)
+	}
+	return
+}
+
+func (c Client) accountURL() string {
+	u := c.apiURL()
+	u.Path = c.accountPath()
+	return u.String()
+}
+
+func (c Client) accountPath() string {
+	return fmt.Sprintf("%d/users/get_current_account", c.Version)
+}
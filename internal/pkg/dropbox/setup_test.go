@@ -0,0 +1,124 @@
+package dropbox
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFolders(t *testing.T) {
+	assert := assert.New(t)
+	home := tempDir(t)
+	for _, dir := range []string{"Dropbox", "Dropbox (Company)", ".dropbox"} {
+		os.MkdirAll(filepath.Join(home, dir), 0700)
+	}
+	elsewhere := tempDir(t)
+	info := filepath.Join(home, ".dropbox", "info.json")
+
+	// without an info.json, the usual place is checked
+	assert.Equal([]Folder{{"", "~/Dropbox"}}, detectFolders(home, []string{info}))
+
+	ioutil.WriteFile(info, []byte(`{
+		"personal": {"path": "`+elsewhere+`", "host": 1, "is_team": false, "subscription_type": "Basic"},
+		"business": {"path": "`+filepath.Join(home, "Dropbox (Company)")+`", "host": 2, "is_team": true}
+	}`), 0600)
+	folders := detectFolders(home, []string{info})
+	assert.Equal([]Folder{
+		{"personal", elsewhere},
+		{"business", "~/Dropbox (Company)"},
+		{"", "~/Dropbox"},
+	}, folders)
+	assert.Equal("~/Dropbox (Company) (business)", folders[1].String())
+	assert.Equal("~/Dropbox", folders[2].String())
+
+	// folders that are gone are left out, and each is only listed once
+	ioutil.WriteFile(info, []byte(`{
+		"personal": {"path": "`+filepath.Join(home, "Dropbox")+`"},
+		"business": {"path": "`+filepath.Join(home, "Gone")+`"}
+	}`), 0600)
+	assert.Equal([]Folder{{"personal", "~/Dropbox"}}, detectFolders(home, []string{info}))
+
+	// a damaged info.json is skipped
+	ioutil.WriteFile(info, []byte(`{"personal":`), 0600)
+	assert.Equal([]Folder{{"", "~/Dropbox"}}, detectFolders(home, []string{info}))
+}
+
+func TestGifDirs(t *testing.T) {
+	dir := tempDir(t)
+	for _, sub := range []string{"Photos", "reaction GIFs", "gifs", "Documents"} {
+		os.MkdirAll(filepath.Join(dir, sub), 0700)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "not a dir.gif"), nil, 0600)
+
+	assert.Equal(t, []string{"/gifs", "/reaction GIFs"}, GifDirs(dir))
+	assert.Empty(t, GifDirs(filepath.Join(dir, "missing")))
+}
+
+func TestConfigSave(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(tempDir(t), "config", ".dgl.json")
+	d := Config{DropboxPath: "~/Dropbox", GifDir: "/gifs", APIToken: "API_TOKEN", Loaded: true}
+
+	assert.Nil(d.Save(path))
+	info, err := os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	raw, _ := ioutil.ReadFile(path)
+	assert.Equal("{\n\t\"dropbox_path\": \"~/Dropbox\",\n\t\"dropbox_gif_dir\": \"/gifs\",\n\t\"dropbox_api_token\": \"API_TOKEN\"\n}\n", string(raw))
+
+	saved, _ := createFromConfig(path)
+	ok, err := saved.validate()
+	assert.True(ok)
+	assert.Nil(err)
+	assert.Equal("API_TOKEN", saved.Token())
+
+	// an existing config is replaced, and made private
+	os.Chmod(path, 0644)
+	d.GifDir = "/reactions"
+	assert.Nil(d.Save(path))
+	info, _ = os.Stat(path)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	saved, _ = createFromConfig(path)
+	assert.Equal("/reactions", saved.GifDir)
+}
+
+func TestClientCurrentAccount(t *testing.T) {
+	assert := assert.New(t)
+	var body string
+	apiStub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		assert.Equal("/3/users/get_current_account", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer "+apiToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(invalidTokenResponse()))
+			return
+		}
+		w.Write([]byte(`{"account_id": "dbid:AAH4f99", "name": {"display_name": "Taylor Swift"}, "email": "taylor@example.com", "email_verified": true}`))
+	}))
+	defer apiStub.Close()
+
+	c := newClient(validConfig)
+	c.Host, c.Version = apiStub.URL, version
+	account, err := c.CurrentAccount(context.Background())
+	assert.Nil(err)
+	assert.Equal("null", body)
+	assert.Equal("dbid:AAH4f99", account.ID)
+	assert.Equal("Taylor Swift (taylor@example.com)", account.String())
+
+	c = newClient(testConfig{fullPath, gifDir, "bad", true})
+	c.Host, c.Version = apiStub.URL, version
+	_, err = c.CurrentAccount(context.Background())
+	assert.True(errors.Is(err, ErrInvalidToken))
+
+	_, err = newClient(invalidConfig).CurrentAccount(context.Background())
+	assert.Equal("client is not valid", err.Error())
+}
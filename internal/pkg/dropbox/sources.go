@@ -0,0 +1,255 @@
+package dropbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/httpclient"
+)
+
+// ConfigEnv is the environment variable naming the config file to load
+const ConfigEnv = "DGL_CONFIG"
+
+// envPrefix starts the environment variables that override each setting
+const envPrefix = "DGL_"
+
+// Environments are the environments the config can be set to. The first is the
+// default, and the development environment keeps its own database and sync files.
+var Environments = []string{"production", "development"}
+
+// configOverride is the config file given on the command line, if any
+var configOverride string
+
+// SetConfigPath loads the config from the path, instead of looking for it
+func SetConfigPath(path string) {
+	configOverride = path
+}
+
+// ConfigFile returns the config file to load, and why it was picked. The first
+// of these is used: the --config flag, $DGL_CONFIG, the XDG config file, then
+// ~/.dgl.json, which is also where a new config goes when none exist.
+func ConfigFile() (path string, reason string) {
+	if configOverride != "" {
+		return expandPath(configOverride), "--config"
+	}
+	if path = os.Getenv(ConfigEnv); path != "" {
+		return expandPath(path), "$" + ConfigEnv
+	}
+	if path = xdgConfigPath(); configExists(path) {
+		return path, "XDG config"
+	}
+	return configPath(configFilename), "home directory"
+}
+
+// xdgConfigPath provides the path to the config in the XDG config directory
+func xdgConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = configPath(".config")
+	}
+	return filepath.Join(dir, "dropbox-gif-linker", "config.json")
+}
+
+// Setting is a setting in the config, along with where its value came from
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// setting is a field in the config, by its key in the file
+type setting struct {
+	key string
+	// field returns a pointer to the field
+	field func(c *Config) interface{}
+	// show hides the value of a secret setting, when shown
+	show func(value string) string
+}
+
+// settings are every field in the config. Nested keys are joined with dots.
+var settings = []setting{
+	{key: "dropbox_path", field: func(c *Config) interface{} { return &c.DropboxPath }},
+	{key: "dropbox_gif_dir", field: func(c *Config) interface{} { return &c.GifDir }},
+	{key: "dropbox_api_token", field: func(c *Config) interface{} { return &c.APIToken }, show: MaskToken},
+	{key: "token_env", field: func(c *Config) interface{} { return &c.TokenEnv }},
+	{key: "token_command", field: func(c *Config) interface{} { return &c.TokenCmd }, show: hideCommand},
+	{key: "token_file", field: func(c *Config) interface{} { return &c.TokenFile }},
+	{key: "app_key", field: func(c *Config) interface{} { return &c.App }},
+	{key: "templates", field: func(c *Config) interface{} { return &c.Templates }},
+	{key: "storage", field: func(c *Config) interface{} { return &c.StorageType }},
+	{key: "sync", field: func(c *Config) interface{} { return &c.Sync }},
+	{key: "machine_name", field: func(c *Config) interface{} { return &c.Machine }},
+	{key: "environment", field: func(c *Config) interface{} { return &c.Env }},
+	{key: "http.timeout", field: func(c *Config) interface{} { return &c.httpFields().Timeout }},
+	{key: "http.retries", field: func(c *Config) interface{} { return &c.httpFields().Retries }},
+	{key: "http.backoff", field: func(c *Config) interface{} { return &c.httpFields().Backoff }},
+	{key: "http.max_backoff", field: func(c *Config) interface{} { return &c.httpFields().MaxBackoff }},
+}
+
+// env returns the environment variable that overrides the setting
+func (s setting) env() string {
+	return envPrefix + strings.ToUpper(strings.Replace(s.key, ".", "_", -1))
+}
+
+// get returns the setting's value as text
+func (s setting) get(c Config) string {
+	switch field := s.field(&c).(type) {
+	case *string:
+		return *field
+	case *bool:
+		return strconv.FormatBool(*field)
+	case **int:
+		if *field == nil {
+			return ""
+		}
+		return strconv.Itoa(**field)
+	case *map[string]string:
+		var names []string
+		for name := range *field {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, ", ")
+	}
+	return ""
+}
+
+// set reads the setting's value from text
+func (s setting) set(c *Config, value string) error {
+	switch field := s.field(c).(type) {
+	case *string:
+		*field = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%v should be true or false instead of \"%v\"", s.env(), value)
+		}
+		*field = b
+	case **int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%v should be a number instead of \"%v\"", s.env(), value)
+		}
+		*field = &n
+	case *map[string]string:
+		if err := json.Unmarshal([]byte(value), field); err != nil {
+			return fmt.Errorf("%v should be a JSON object of names to templates", s.env())
+		}
+	}
+	return nil
+}
+
+// httpFields returns the http settings, adding them when there are none
+func (c *Config) httpFields() *HTTPConfig {
+	if c.HTTP == nil {
+		c.HTTP = &HTTPConfig{}
+	}
+	return c.HTTP
+}
+
+// fileSources records which settings are in the config file
+func (c *Config) fileSources(raw []byte) {
+	for _, key := range keys(raw) {
+		c.source(key, c.Path)
+	}
+}
+
+// keys returns the keys of the settings in the JSON
+func keys(raw []byte) (found []string) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return
+	}
+	var nested map[string]json.RawMessage
+	json.Unmarshal(fields["http"], &nested)
+	for key := range nested {
+		fields["http."+key] = nil
+	}
+	for _, s := range settings {
+		if _, ok := fields[s.key]; ok {
+			found = append(found, s.key)
+		}
+	}
+	return
+}
+
+// applyEnv overrides each setting with its DGL_ environment variable, when set,
+// returning how many were
+func (c *Config) applyEnv() (overridden int, err error) {
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env())
+		if !ok {
+			continue
+		}
+		if err = s.set(c, value); err != nil {
+			return
+		}
+		c.source(s.key, "$"+s.env())
+		overridden++
+	}
+	return
+}
+
+func (c *Config) source(key string, source string) {
+	if c.sources == nil {
+		c.sources = map[string]string{}
+	}
+	c.sources[key] = source
+}
+
+// Settings returns every setting along with where it came from: the config
+// file, an environment variable, or the default. Secrets are masked.
+func (c Config) Settings() (list []Setting) {
+	defaults := c.defaults()
+	profile := Setting{"profile", c.profile, c.sources["profile"]}
+	if profile.Source == "" {
+		profile.Source = "default"
+	}
+	list = append(list, profile)
+	for _, s := range settings {
+		value := s.get(c)
+		source, ok := c.sources[s.key]
+		if !ok {
+			source = "default"
+			value = defaults[s.key]
+		}
+		if s.show != nil && value != "" {
+			value = s.show(value)
+		}
+		list = append(list, Setting{s.key, value, source})
+	}
+	return
+}
+
+// defaults returns the value used for each setting that isn't set
+func (c Config) defaults() map[string]string {
+	d := httpclient.DefaultSettings
+	return map[string]string{
+		"storage":          "bolt",
+		"sync":             "false",
+		"machine_name":     Config{}.MachineName(),
+		"environment":      Environments[0],
+		"http.timeout":     d.Timeout.String(),
+		"http.retries":     strconv.Itoa(d.Retries),
+		"http.backoff":     d.Backoff.String(),
+		"http.max_backoff": d.MaxBackoff.String(),
+	}
+}
+
+// hideCommand hides the token_command, which can hold secrets of its own
+func hideCommand(string) string {
+	return "(set)"
+}
+
+// expandPath expands a leading ~ to the home directory
+func expandPath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return configPath(path[2:])
+	}
+	return path
+}
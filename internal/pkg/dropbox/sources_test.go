@@ -0,0 +1,168 @@
+package dropbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+)
+
+// settingsByKey returns the settings keyed by name
+func settingsByKey(d Config) map[string]Setting {
+	byKey := map[string]Setting{}
+	for _, s := range d.Settings() {
+		byKey[s.Key] = s
+	}
+	return byKey
+}
+
+func TestConfigFile(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfigPath("")
+	xdg := tempDir(t)
+	setenv(t, "XDG_CONFIG_HOME", xdg)
+	setenv(t, ConfigEnv, "")
+	os.Unsetenv(ConfigEnv)
+
+	path, reason := ConfigFile()
+	assert.Equal(configPath(configFilename), path)
+	assert.Equal("home directory", reason)
+
+	xdgConfig := filepath.Join(xdg, "dropbox-gif-linker", "config.json")
+	os.MkdirAll(filepath.Dir(xdgConfig), 0700)
+	ioutil.WriteFile(xdgConfig, []byte("{}"), 0600)
+	path, reason = ConfigFile()
+	assert.Equal(xdgConfig, path)
+	assert.Equal("XDG config", reason)
+
+	os.Setenv(ConfigEnv, "~/from-env.json")
+	path, reason = ConfigFile()
+	assert.Equal(configPath("from-env.json"), path)
+	assert.Equal("$DGL_CONFIG", reason)
+
+	SetConfigPath("/from/flag.json")
+	path, reason = ConfigFile()
+	assert.Equal("/from/flag.json", path)
+	assert.Equal("--config", reason)
+	assert.Equal("/from/flag.json", DefaultConfigPath())
+}
+
+func TestConfigEnvOverrides(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfigPath("")
+	SetConfigPath(httpConfigFilename)
+	setenv(t, "DGL_STORAGE", "json")
+	setenv(t, "DGL_SYNC", "true")
+	setenv(t, "DGL_HTTP_RETRIES", "7")
+	setenv(t, "DGL_ENVIRONMENT", "production")
+	setenv(t, "DGL_TEMPLATES", `{"wiki": "[[File:{{.BaseName}}]]"}`)
+
+	d, err := NewConfig()
+	assert.Nil(err)
+	assert.Equal("json", d.Storage())
+	assert.True(d.SyncEnabled())
+	assert.Equal(7, d.HTTPSettings().Retries)
+	assert.Equal("production", d.Environment())
+	assert.Equal("[[File:{{.BaseName}}]]", d.OutputTemplates()["wiki"])
+
+	byKey := settingsByKey(d)
+	assert.Equal(Setting{"dropbox_path", "~/Dropbox", httpConfigFilename}, byKey["dropbox_path"])
+	assert.Equal(Setting{"dropbox_api_token", "*********", httpConfigFilename}, byKey["dropbox_api_token"])
+	assert.Equal(Setting{"storage", "json", "$DGL_STORAGE"}, byKey["storage"])
+	assert.Equal(Setting{"sync", "true", "$DGL_SYNC"}, byKey["sync"])
+	assert.Equal(Setting{"http.timeout", "10s", httpConfigFilename}, byKey["http.timeout"])
+	assert.Equal(Setting{"http.retries", "7", "$DGL_HTTP_RETRIES"}, byKey["http.retries"])
+	assert.Equal(Setting{"templates", "wiki", "$DGL_TEMPLATES"}, byKey["templates"])
+	assert.Equal(Setting{"token_file", "", "default"}, byKey["token_file"])
+	assert.Equal(Setting{"profile", "", "default"}, d.Settings()[0])
+	assert.Len(d.Settings(), len(settings)+1)
+
+	// the environment is checked too
+	os.Setenv("DGL_ENVIRONMENT", "staging")
+	_, err = NewConfig()
+	assert.Contains(err.Error(), "the environment should be one of production, development instead of \"staging\"")
+
+	os.Setenv("DGL_SYNC", "maybe")
+	_, err = NewConfig()
+	assert.Equal("DGL_SYNC should be true or false instead of \"maybe\"", err.Error())
+}
+
+// emptyHome points the home directory at an empty one, without any config
+func emptyHome(t *testing.T) string {
+	home := tempDir(t)
+	setenv(t, "HOME", home)
+	setenv(t, "XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	os.Unsetenv(ConfigEnv)
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	return home
+}
+
+func TestConfigFromEnvOnly(t *testing.T) {
+	assert := assert.New(t)
+	emptyHome(t)
+
+	_, err := NewConfig()
+	assert.Contains(err.Error(), "Please setup your config file")
+
+	setenv(t, "DGL_DROPBOX_PATH", "~/Dropbox")
+	setenv(t, "DGL_DROPBOX_GIF_DIR", "gifs")
+	setenv(t, "DGL_DROPBOX_API_TOKEN", "FROM_ENV_TOKEN_1234")
+	d, err := NewConfig()
+	assert.Nil(err)
+	assert.Equal("/gifs", d.GifsPath())
+	assert.Equal("", d.LoadedPath())
+
+	byKey := settingsByKey(d)
+	assert.Equal(Setting{"dropbox_api_token", "********1234", "$DGL_DROPBOX_API_TOKEN"}, byKey["dropbox_api_token"])
+	assert.Equal(Setting{"storage", "bolt", "default"}, byKey["storage"])
+	assert.Equal(Setting{"http.retries", "3", "default"}, byKey["http.retries"])
+	assert.Equal(Setting{"environment", "production", "default"}, byKey["environment"])
+}
+
+func TestSettingEnv(t *testing.T) {
+	assert := assert.New(t)
+	names := map[string]bool{}
+	for _, s := range settings {
+		names[s.env()] = true
+	}
+	assert.True(names["DGL_DROPBOX_GIF_DIR"])
+	assert.True(names["DGL_TOKEN_COMMAND"])
+	assert.True(names["DGL_HTTP_MAX_BACKOFF"])
+	assert.Len(names, len(settings))
+
+	d := Config{TokenCmd: "pass show dropbox"}
+	d.source("token_command", "file")
+	assert.Equal("(set)", settingsByKey(d)["token_command"].Value)
+}
+
+func TestConfigUnreadable(t *testing.T) {
+	assert := assert.New(t)
+	defer SetConfigPath("")
+	home := emptyHome(t)
+	setenv(t, "DGL_DROPBOX_PATH", "~/Dropbox")
+	setenv(t, "DGL_DROPBOX_GIF_DIR", "gifs")
+	setenv(t, "DGL_DROPBOX_API_TOKEN", "FROM_ENV_TOKEN_1234")
+
+	// a config that was asked for has to be there, even with the environment set
+	SetConfigPath(missingConfigFilename)
+	_, err := NewConfig()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "unable to read the config from --config")
+
+	SetConfigPath("")
+	os.Setenv(ConfigEnv, missingConfigFilename)
+	_, err = NewConfig()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "unable to read the config from $DGL_CONFIG")
+	os.Unsetenv(ConfigEnv)
+
+	// as does one that exists, but can't be read
+	os.Mkdir(filepath.Join(home, configFilename), 0700)
+	_, err = NewConfig()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "unable to read the config from home directory")
+}
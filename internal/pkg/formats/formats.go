@@ -0,0 +1,171 @@
+package formats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+// Format renders a record for a particular destination
+type Format struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Render      func(gifkv.Record) string
+	// execute renders formats that can fail, like templates, in place of Render
+	execute func(gifkv.Record) (string, error)
+}
+
+var registry []Format
+
+func init() {
+	builtins := []Format{
+		{"url", []string{"u"}, "URL", gifkv.Record.URL, nil},
+		{"md", []string{"m", "markdown"}, "Markdown", gifkv.Record.Markdown, nil},
+		{"bbcode", []string{"b"}, "BBCode", gifkv.Record.BBCode, nil},
+		{"html", nil, "HTML", gifkv.Record.HTML, nil},
+		{"rst", []string{"restructuredtext"}, "reStructuredText", rst, nil},
+		{"org", []string{"orgmode"}, "Org-mode", org, nil},
+		{"slack", nil, "Slack", slack, nil},
+		{"discord", nil, "Discord", discord, nil},
+		{"json", nil, "JSON", jsonObject, nil},
+	}
+	for _, f := range builtins {
+		Register(f)
+	}
+}
+
+// Register adds a format, as long as its name and aliases are not yet taken
+func Register(f Format) error {
+	if f.Name == "" || (f.Render == nil && f.execute == nil) {
+		return fmt.Errorf("the %q format is incomplete", f.Name)
+	}
+	for _, name := range f.Names() {
+		if _, exists := Lookup(name); exists {
+			return fmt.Errorf("the %q format is already registered", name)
+		}
+	}
+	registry = append(registry, f)
+	return nil
+}
+
+// RegisterTemplate adds a format rendered by a text/template, which has
+// access to every field and method of the record
+func RegisterTemplate(name string, text string) error {
+	tmpl, err := ParseTemplate(name, text)
+	if err != nil {
+		return err
+	}
+	execute := func(r gifkv.Record) (string, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, r); err != nil {
+			return "", fmt.Errorf("the %v template failed: %v", name, err)
+		}
+		return buf.String(), nil
+	}
+	return Register(Format{Name: name, Description: fmt.Sprintf("%q Template", name), execute: execute})
+}
+
+// ParseTemplate parses the template, then renders an empty record with it, so
+// a misspelled field is caught before any link is
+func ParseTemplate(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err == nil {
+		err = tmpl.Execute(ioutil.Discard, gifkv.Record{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("the %v template is invalid: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// Unregister removes the named format, returning whether there was one to remove
+func Unregister(name string) bool {
+	for i, f := range registry {
+		if f.Name == name {
+			registry = append(registry[:i:i], registry[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the format matching the name or one of its aliases
+func Lookup(input string) (f Format, ok bool) {
+	input = strings.TrimPrefix(input, ":")
+	for _, f = range registry {
+		for _, name := range f.Names() {
+			if input == name {
+				ok = true
+				return
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// All returns every registered format, in the order registered
+func All() []Format {
+	return append([]Format(nil), registry...)
+}
+
+// Names returns the name of every registered format
+func Names() (names []string) {
+	for _, f := range registry {
+		names = append(names, f.Name)
+	}
+	return
+}
+
+// Output renders the record, or returns why it couldn't be
+func (f Format) Output(r gifkv.Record) (string, error) {
+	if f.execute != nil {
+		return f.execute(r)
+	}
+	return f.Render(r), nil
+}
+
+// Names returns the name followed by the aliases of the format
+func (f Format) Names() []string {
+	return append([]string{f.Name}, f.Aliases...)
+}
+
+func rst(r gifkv.Record) string {
+	output := fmt.Sprintf(".. image:: %v\n   :alt: %v", r.URL(), r.BaseName)
+	if r.Width > 0 && r.Height > 0 {
+		output += fmt.Sprintf("\n   :width: %dpx\n   :height: %dpx", r.Width, r.Height)
+	}
+	return output
+}
+
+func org(r gifkv.Record) string {
+	return fmt.Sprintf("[[%v][%v]]", r.URL(), r.BaseName)
+}
+
+func slack(r gifkv.Record) string {
+	return fmt.Sprintf("<%v|%v>", r.URL(), r.BaseName)
+}
+
+func discord(r gifkv.Record) string {
+	return fmt.Sprintf("[%v](%v)", r.BaseName, r.URL())
+}
+
+type jsonRecord struct {
+	URL      string   `json:"url"`
+	Name     string   `json:"name"`
+	Tags     []string `json:"tags"`
+	FileSize int      `json:"file_size"`
+	Width    int      `json:"width,omitempty"`
+	Height   int      `json:"height,omitempty"`
+	Checksum string   `json:"checksum"`
+}
+
+func jsonObject(r gifkv.Record) string {
+	data, _ := json.Marshal(jsonRecord{r.URL(), r.BaseName, r.TagList(), r.FileSize, r.Width, r.Height, r.ID})
+	return string(data)
+}
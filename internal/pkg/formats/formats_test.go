@@ -0,0 +1,139 @@
+package formats
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+func generateRecord() (r gifkv.Record) {
+	r.ID = "1989"
+	r.BaseName = "shake it off.gif"
+	r.Directory = "/taylor swift/dancing"
+	r.FileSize = 3456
+	r.RemotePath = "s/DROPBOX_HASH"
+	return
+}
+
+func TestBuiltins(t *testing.T) {
+	assert.Equal(t, []string{"url", "md", "bbcode", "html", "rst", "org", "slack", "discord", "json"}, Names())
+}
+
+func TestLookup(t *testing.T) {
+	assert := assert.New(t)
+
+	f, ok := Lookup("md")
+	assert.True(ok)
+	assert.Equal("md", f.Name)
+
+	f, ok = Lookup("markdown")
+	assert.True(ok)
+	assert.Equal("md", f.Name)
+
+	f, ok = Lookup(":b")
+	assert.True(ok)
+	assert.Equal("bbcode", f.Name)
+
+	f, ok = Lookup("bogus")
+	assert.False(ok)
+	assert.Equal(Format{}, f)
+}
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+	defer func(original []Format) { registry = original }(All())
+
+	render := func(r gifkv.Record) string { return r.BaseName }
+
+	err := Register(Format{Name: "name", Aliases: []string{"n"}, Render: render})
+	assert.Nil(err)
+	f, ok := Lookup("n")
+	assert.True(ok)
+	assert.Equal("shake it off.gif", f.Render(generateRecord()))
+	output, err := f.Output(generateRecord())
+	assert.Nil(err)
+	assert.Equal("shake it off.gif", output)
+
+	err = Register(Format{Name: "other", Aliases: []string{"u"}, Render: render})
+	assert.NotNil(err)
+	assert.Equal("the \"u\" format is already registered", err.Error())
+
+	err = Register(Format{Name: "empty"})
+	assert.NotNil(err)
+	assert.Equal("the \"empty\" format is incomplete", err.Error())
+}
+
+func TestRegisterTemplate(t *testing.T) {
+	assert := assert.New(t)
+	defer func(original []Format) { registry = original }(All())
+	r := generateRecord()
+	r.Width = 480
+	r.Height = 270
+
+	err := RegisterTemplate("wiki", "[[File:{{.BaseName}}|link={{.URL}}|{{.Width}}x{{.Height}}px]] ({{.Tags}})")
+	assert.Nil(err)
+	f, ok := Lookup("wiki")
+	assert.True(ok)
+	assert.Equal("\"wiki\" Template", f.Description)
+	output, err := f.Output(r)
+	assert.Nil(err)
+	assert.Equal(fmt.Sprintf("[[File:shake it off.gif|link=%v|480x270px]] (taylor swift, dancing)", r.URL()), output)
+
+	// a misspelled field is caught when the template is registered
+	err = RegisterTemplate("missing", "{{.Nmae}}")
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "the missing template is invalid: ")
+	_, ok = Lookup("missing")
+	assert.False(ok)
+
+	// and one only some records reach fails as an error, not as the link
+	err = RegisterTemplate("sized", "{{if .Width}}{{.Size}}{{end}}")
+	assert.Nil(err)
+	f, _ = Lookup("sized")
+	output, err = f.Output(r)
+	assert.Equal("", output)
+	assert.Contains(err.Error(), "the sized template failed: ")
+
+	err = RegisterTemplate("broken", "{{.URL}")
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "the broken template is invalid: ")
+
+	err = RegisterTemplate("md", "{{.URL}}")
+	assert.NotNil(err)
+	assert.Equal("the \"md\" format is already registered", err.Error())
+}
+
+func TestUnregister(t *testing.T) {
+	assert := assert.New(t)
+	defer func(original []Format) { registry = original }(All())
+	before := Names()
+
+	assert.Nil(RegisterTemplate("wiki", "{{.URL}}"))
+	assert.True(Unregister("wiki"))
+	_, ok := Lookup("wiki")
+	assert.False(ok)
+	assert.Equal(before, Names())
+	assert.False(Unregister("wiki"))
+
+	// the template can be registered again, as a profile switches back
+	assert.Nil(RegisterTemplate("wiki", "{{.BaseName}}"))
+}
+
+func TestRenderers(t *testing.T) {
+	assert := assert.New(t)
+	r := generateRecord()
+	url := r.URL()
+
+	assert.Equal(fmt.Sprintf(".. image:: %v\n   :alt: shake it off.gif", url), rst(r))
+	assert.Equal(fmt.Sprintf("[[%v][shake it off.gif]]", url), org(r))
+	assert.Equal(fmt.Sprintf("<%v|shake it off.gif>", url), slack(r))
+	assert.Equal(fmt.Sprintf("[shake it off.gif](%v)", url), discord(r))
+	assert.Equal(fmt.Sprintf("{\"url\":\"%v\",\"name\":\"shake it off.gif\",\"tags\":[\"taylor swift\",\"dancing\"],\"file_size\":3456,\"checksum\":\"1989\"}", url), jsonObject(r))
+
+	r.Width = 480
+	r.Height = 270
+	assert.Equal(fmt.Sprintf(".. image:: %v\n   :alt: shake it off.gif\n   :width: 480px\n   :height: 270px", url), rst(r))
+	assert.Equal(fmt.Sprintf("{\"url\":\"%v\",\"name\":\"shake it off.gif\",\"tags\":[\"taylor swift\",\"dancing\"],\"file_size\":3456,\"width\":480,\"height\":270,\"checksum\":\"1989\"}", url), jsonObject(r))
+}
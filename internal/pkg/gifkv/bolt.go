@@ -0,0 +1,112 @@
+package gifkv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// BoltStore keeps the records in a bolt database, with secondary indexes
+type BoltStore struct {
+	path     string
+	db       *bolt.DB
+	readOnly bool
+}
+
+// OpenBolt opens the bolt database at path, creating it (and its buckets) unless
+// it is opened read-only
+func OpenBolt(path string, options Options) (s *BoltStore, err error) {
+	if path == "" {
+		return nil, errors.New("no database path set")
+	}
+	if options.ReadOnly {
+		// bolt would create an empty file it cannot initialize, leaving it locked
+		if _, err = os.Stat(path); os.IsNotExist(err) {
+			return nil, fmt.Errorf("the database %v has not been created yet", path)
+		}
+	} else if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return
+	}
+	db, err := openWithRetries(path, options)
+	if err != nil {
+		return
+	}
+	s = &BoltStore{path: path, db: db, readOnly: options.ReadOnly}
+	if options.ReadOnly {
+		err = s.view(func(tx *bolt.Tx) error {
+			if tx.Bucket([]byte(bucketName)) == nil {
+				return fmt.Errorf("the database %v has not been created yet", path)
+			}
+			return nil
+		})
+	} else {
+		err = s.update(func(tx *bolt.Tx) error {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucketName)); err != nil {
+				return err
+			}
+			return createIndexes(tx)
+		})
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return
+}
+
+// openWithRetries opens the bolt database, backing off while another process holds the lock
+func openWithRetries(path string, options Options) (db *bolt.DB, err error) {
+	backoff := options.Backoff
+	for attempt := 0; ; attempt++ {
+		db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: options.Timeout, ReadOnly: options.ReadOnly})
+		if err != bolt.ErrTimeout {
+			return
+		}
+		if attempt >= options.Retries {
+			return nil, fmt.Errorf("%w (%v)", ErrLocked, path)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Close releases the database
+func (s *BoltStore) Close() error {
+	if s == nil || s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// Path returns the database file path
+func (s *BoltStore) Path() string {
+	return s.path
+}
+
+// ReadOnly returns whether the store was opened read-only
+func (s *BoltStore) ReadOnly() bool {
+	return s.readOnly
+}
+
+func (s *BoltStore) view(fn func(*bolt.Tx) error) error {
+	if s == nil || s.db == nil {
+		return errNotConnected
+	}
+	return s.db.View(fn)
+}
+
+func (s *BoltStore) update(fn func(*bolt.Tx) error) error {
+	if s == nil || s.db == nil {
+		return errNotConnected
+	}
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	return s.db.Update(fn)
+}
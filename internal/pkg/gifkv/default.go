@@ -0,0 +1,281 @@
+package gifkv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/httpclient"
+)
+
+// The package-level functions work with a default store at the database path,
+// opened by Connect and closed by Disconnect
+
+var databasePath string
+var storage = BoltStorage
+var defaultStore Store = disconnected{}
+var syncConfig *SyncConfig
+var httpClient httpclient.Doer = httpclient.Default()
+
+// SetDatabasePath sets the db path
+func SetDatabasePath(filePath string) (ok bool, err error) {
+	filePath, err = homedir.Expand(filePath)
+	if err != nil {
+		return
+	}
+	databasePath = filePath
+	ok = true
+	return
+}
+
+// GetDatabasePath returns the db path
+func GetDatabasePath() string {
+	return databasePath
+}
+
+func resetDatabasePath() {
+	databasePath = ""
+}
+
+// SetStorage sets the type of store used for the database path
+func SetStorage(kind string) (ok bool, err error) {
+	if kind != BoltStorage && kind != JSONStorage {
+		err = fmt.Errorf("unsupported storage [%v]", kind)
+		return
+	}
+	storage = kind
+	ok = true
+	return
+}
+
+// GetStorage returns the type of store used for the database path
+func GetStorage() string {
+	return storage
+}
+
+// SetHTTPClient sets the client used to check links
+func SetHTTPClient(client httpclient.Doer) {
+	httpClient = client
+}
+
+// SetSync keeps the default store in sync with other machines through the
+// change logs in the config's directory
+func SetSync(config SyncConfig) (ok bool, err error) {
+	if config.Dir == "" || config.Machine == "" {
+		err = errors.New("syncing needs a directory and a machine name")
+		return
+	}
+	syncConfig = &config
+	ok = true
+	return
+}
+
+// StopSync stops keeping the default store in sync, as when switching to a
+// config without syncing
+func StopSync() {
+	syncConfig = nil
+}
+
+// syncStatePath is where the default store remembers how far it has synced
+func syncStatePath() string {
+	if syncConfig.State != "" {
+		return syncConfig.State
+	}
+	return filepath.Join(filepath.Dir(databasePath), "sync.json")
+}
+
+// Init queues up the database connection, migrating any older records
+func Init() (ok bool, err error) {
+	return initialize(true)
+}
+
+// InitWithoutMigrations queues up the database connection, leaving any older
+// records as they are so pending migrations can be inspected
+func InitWithoutMigrations() (ok bool, err error) {
+	return initialize(false)
+}
+
+func initialize(migrate bool) (ok bool, err error) {
+	options := DefaultOptions
+	options.Storage = storage
+	s, err := Open(databasePath, options)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	if b, isBolt := s.(*BoltStore); isBolt && migrate {
+		_, err = b.Migrate(false)
+		if err != nil {
+			return
+		}
+	}
+	ok = true
+	return
+}
+
+// Connect opens the default store, waiting for other processes to let go of it
+func Connect() (ok bool, err error) {
+	return connect(DefaultOptions)
+}
+
+// ConnectReadOnly opens the default store for reading, alongside any other readers
+func ConnectReadOnly() (ok bool, err error) {
+	options := DefaultOptions
+	options.ReadOnly = true
+	return connect(options)
+}
+
+func connect(options Options) (ok bool, err error) {
+	Disconnect()
+	options.Storage = storage
+	s, err := Open(databasePath, options)
+	if err != nil {
+		return
+	}
+	if syncConfig != nil && !options.ReadOnly {
+		var synced *SyncStore
+		if synced, err = NewSyncStore(s, *syncConfig, syncStatePath()); err == nil {
+			_, err = synced.Pull()
+		}
+		if err != nil {
+			s.Close()
+			return
+		}
+		s = synced
+	}
+	defaultStore = s
+	ok = true
+	return
+}
+
+// Disconnect closes the default store, letting other processes use the database
+func Disconnect() {
+	defaultStore.Close()
+	defaultStore = disconnected{}
+}
+
+func removeDatabase() (ok bool, err error) {
+	if databasePath == "" {
+		err = errors.New("no database path set")
+		return
+	}
+	err = os.Remove(databasePath)
+	if err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+// Count returns the number of gifs cached in the default store
+func Count() int {
+	return defaultStore.Count()
+}
+
+// Find looks up a record by checksum in the default store
+func Find(checksum string) (Record, error) {
+	return defaultStore.Find(checksum)
+}
+
+// Each calls fn with every record in the default store, stopping at the first error
+func Each(fn func(Record) error) error {
+	return defaultStore.Iterate(fn)
+}
+
+// Search returns the records in the default store whose name or tags match every term
+func Search(terms string) ([]Record, error) {
+	return search(defaultStore, terms)
+}
+
+// Recent returns up to limit records from the default store, most recently copied first
+func Recent(limit int) ([]Record, error) {
+	return recent(defaultStore, limit)
+}
+
+// Top returns up to limit records from the default store, most frequently copied first
+func Top(limit int) ([]Record, error) {
+	return top(defaultStore, limit)
+}
+
+// FindByName returns the records in the default store with the base name, ignoring case
+func FindByName(name string) ([]Record, error) {
+	return lookup(defaultStore, nameIndex, strings.ToLower(name))
+}
+
+// FindByTag returns the records in the default store with the tag, ignoring case
+func FindByTag(tag string) ([]Record, error) {
+	return lookup(defaultStore, tagIndex, strings.ToLower(tag))
+}
+
+// FindBySharedLinkID looks up a record in the default store by its Dropbox shared link ID
+func FindBySharedLinkID(id string) (Record, error) {
+	return first(defaultStore, sharedLinkIndex, id, "shared link id")
+}
+
+// FindByRemotePath looks up a record in the default store by its remote path
+func FindByRemotePath(remotePath string) (Record, error) {
+	return first(defaultStore, remotePathIndex, remotePath, "remote path")
+}
+
+// Sync pulls every change log into the default store, and merges any conflicted
+// copies of the shared database
+func Sync() (SyncReport, error) {
+	if synced, ok := defaultStore.(*SyncStore); ok {
+		return synced.Sync()
+	}
+	return SyncReport{}, errors.New("syncing is turned off")
+}
+
+// RebuildIndexes regenerates the default store's secondary indexes. Only bolt
+// stores keep indexes.
+func RebuildIndexes() (int, error) {
+	if b, ok := local(defaultStore).(*BoltStore); ok {
+		return b.RebuildIndexes()
+	}
+	return 0, fmt.Errorf("the %v storage does not keep indexes", storage)
+}
+
+// Migrate upgrades the default store's schema. Only bolt stores hold older records.
+func Migrate(dryRun bool) (MigrationReport, error) {
+	if b, ok := local(defaultStore).(*BoltStore); ok {
+		return b.Migrate(dryRun)
+	}
+	if _, ok := defaultStore.(disconnected); ok {
+		return MigrationReport{}, errNotConnected
+	}
+	return MigrationReport{From: SchemaVersion(), To: SchemaVersion()}, nil
+}
+
+// Export writes every record in the default store in the format
+func Export(w io.Writer, format string) (int, error) {
+	return export(defaultStore, w, format)
+}
+
+// Import reads records in the format into the default store
+func Import(r io.Reader, format string, policy ImportPolicy) (ImportReport, error) {
+	return importFrom(defaultStore, r, format, policy)
+}
+
+// ImportRecords saves the records to the default store
+func ImportRecords(records []Record, policy ImportPolicy) (ImportReport, error) {
+	return importRecords(defaultStore, records, policy)
+}
+
+// Copied tracks that the record's link was copied, and saves it to the default store
+func (r *Record) Copied() (bool, error) {
+	return copied(defaultStore, r)
+}
+
+// Save captures the record to the default store
+func (r *Record) Save() (bool, error) {
+	return defaultStore.Save(r)
+}
+
+// Delete removes the record from the default store
+func (r *Record) Delete() (bool, error) {
+	return defaultStore.Delete(r)
+}
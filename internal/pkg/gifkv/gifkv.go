@@ -1,79 +1,59 @@
 package gifkv
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	bolt "github.com/coreos/bbolt"
 	humanize "github.com/dustin/go-humanize"
-	homedir "github.com/mitchellh/go-homedir"
 )
 
-var db *bolt.DB
-var databasePath string
-var connected bool
 var bucketName = "gifs"
 var dropboxBaseURL = "https://dl.dropboxusercontent.com"
-
-// SetDatabasePath sets the db path
-func SetDatabasePath(filePath string) (ok bool, err error) {
-	filePath, err = homedir.Expand(filePath)
-	if err != nil {
-		return
-	}
-	databasePath = filePath
-	ok = true
-	return
-}
-
-// GetDatabasePath returns the db path
-func GetDatabasePath() string {
-	return databasePath
-}
-
-func databaseDir() string {
-	if databasePath == "" {
-		return ""
-	}
-	return strings.Replace(databasePath, filepath.Base(databasePath), "", 1)
-}
-
-func resetDatabasePath() {
-	databasePath = ""
-}
+var now = time.Now
 
 // Record of a dropbox-linked gif
 type Record struct {
-	ID           string `json:"checksum"`
-	BaseName     string `json:"base_name"`
-	Directory    string `json:"directory"`
-	FileSize     int    `json:"file_size"`
-	SharedLinkID string `json:"shared_link_id"`
-	RemotePath   string `json:"remote_path"`
+	ID           string    `json:"checksum"`
+	BaseName     string    `json:"base_name"`
+	Directory    string    `json:"directory"`
+	FileSize     int       `json:"file_size"`
+	SharedLinkID string    `json:"shared_link_id"`
+	RemotePath   string    `json:"remote_path"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	Count        int       `json:"count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	CopiedAt     time.Time `json:"copied_at"`
+	Version      int       `json:"version"`
 	persisted    bool
 }
 
 // Count returns the number of gifs cached in the database
-func Count() int {
-	var s bolt.BucketStats
-	db.View(func(tx *bolt.Tx) error {
+func (s *BoltStore) Count() int {
+	var stats bolt.BucketStats
+	s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
-		s = b.Stats()
+		stats = b.Stats()
 		return nil
 	})
-	return s.KeyN
+	return stats.KeyN
 }
 
 // Find looks up a record by checksum
-func Find(checksum string) (record Record, err error) {
-	err = db.View(func(tx *bolt.Tx) error {
+func (s *BoltStore) Find(checksum string) (record Record, err error) {
+	err = s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		v := b.Get([]byte(checksum))
 		if v != nil {
@@ -87,12 +67,134 @@ func Find(checksum string) (record Record, err error) {
 	return
 }
 
-// Save captures the record to the database
-func (r *Record) Save() (bool, error) {
-	err := db.Update(func(tx *bolt.Tx) error {
+// Iterate calls fn with every record in the database, stopping at the first error
+func (s *BoltStore) Iterate(fn func(Record) error) error {
+	return s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
-		err := b.Put([]byte(r.ID), r.json())
-		return err
+		return b.ForEach(func(k, v []byte) error {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			record.persisted = true
+			return fn(record)
+		})
+	})
+}
+
+// search returns the records whose name or tags match every term, best matches first
+func search(s Store, terms string) (records []Record, err error) {
+	words := strings.Fields(strings.ToLower(terms))
+	if len(words) == 0 {
+		err = errors.New("no search terms")
+		return
+	}
+	scores := make(map[string]int)
+	err = s.Iterate(func(r Record) error {
+		if score := r.matches(words); score > 0 {
+			scores[r.ID] = score
+			records = append(records, r)
+		}
+		return nil
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		if scores[records[i].ID] != scores[records[j].ID] {
+			return scores[records[i].ID] > scores[records[j].ID]
+		}
+		return strings.ToLower(records[i].BaseName) < strings.ToLower(records[j].BaseName)
+	})
+	return
+}
+
+// matches scores how well the record matches every word, with 0 being no match.
+// Substrings of the name score highest, followed by substrings of the tags, then
+// fuzzy (in-order, but not necessarily adjacent) matches of either.
+func (r Record) matches(words []string) (score int) {
+	name := strings.ToLower(r.BaseName)
+	tags := strings.ToLower(r.Tags())
+	for _, word := range words {
+		switch {
+		case strings.Contains(name, word):
+			score += 3
+		case strings.Contains(tags, word):
+			score += 2
+		case fuzzy(name, word) || fuzzy(tags, word):
+			score++
+		default:
+			return 0
+		}
+	}
+	return
+}
+
+// fuzzy returns whether every character of the word appears in the text, in order
+func fuzzy(text string, word string) bool {
+	for _, c := range word {
+		i := strings.IndexRune(text, c)
+		if i < 0 {
+			return false
+		}
+		text = text[i+len(string(c)):]
+	}
+	return true
+}
+
+// recent returns up to limit records, most recently copied first
+func recent(s Store, limit int) ([]Record, error) {
+	return ranked(s, limit, func(r Record) bool { return !r.CopiedAt.IsZero() }, func(a, b Record) bool {
+		return a.CopiedAt.After(b.CopiedAt)
+	})
+}
+
+// top returns up to limit records, most frequently copied first
+func top(s Store, limit int) ([]Record, error) {
+	return ranked(s, limit, func(r Record) bool { return r.Count > 0 }, func(a, b Record) bool {
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.CopiedAt.After(b.CopiedAt)
+	})
+}
+
+// ranked returns up to limit of the records kept by the filter, sorted by less
+func ranked(s Store, limit int, keep func(Record) bool, less func(a, b Record) bool) (records []Record, err error) {
+	err = s.Iterate(func(r Record) error {
+		if keep(r) {
+			records = append(records, r)
+		}
+		return nil
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		return less(records[i], records[j])
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return
+}
+
+// copied tracks that the record's link was copied, and saves it. Copying isn't
+// an update to the link, so a saved record keeps its UpdatedAt, and a synced
+// copy can't win over a newer link from another machine.
+func copied(s Store, r *Record) (bool, error) {
+	r.Count++
+	r.CopiedAt = now()
+	if r.UpdatedAt.IsZero() {
+		return s.Save(r)
+	}
+	if err := putAll(s, []Record{*r}); err != nil {
+		return false, err
+	}
+	r.Version = SchemaVersion()
+	r.persisted = true
+	return true, nil
+}
+
+// Save captures the record to the database
+func (s *BoltStore) Save(r *Record) (bool, error) {
+	r.touch()
+	err := s.update(func(tx *bolt.Tx) error {
+		return r.put(tx)
 	})
 	if err != nil {
 		return false, err
@@ -101,12 +203,48 @@ func (r *Record) Save() (bool, error) {
 	return true, nil
 }
 
+// touch stamps the record as saved now, and created now if it is new
+func (r *Record) touch() {
+	saved := now()
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = saved
+	}
+	r.UpdatedAt = saved
+}
+
+// putAll writes the records and their indexes as-is, leaving the timestamps alone
+func (s *BoltStore) putAll(records []Record) error {
+	return s.update(func(tx *bolt.Tx) error {
+		for i := range records {
+			if err := records[i].put(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// put writes the record and its indexes as-is, leaving the timestamps alone
+func (r *Record) put(tx *bolt.Tx) error {
+	r.Version = SchemaVersion()
+	b := tx.Bucket([]byte(bucketName))
+	if err := unindexExisting(tx, r.ID); err != nil {
+		return err
+	}
+	if err := b.Put([]byte(r.ID), r.json()); err != nil {
+		return err
+	}
+	return indexRecord(tx, *r)
+}
+
 // Delete removes the record from the database
-func (r *Record) Delete() (bool, error) {
-	err := db.Update(func(tx *bolt.Tx) error {
+func (s *BoltStore) Delete(r *Record) (bool, error) {
+	err := s.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
-		err := b.Delete([]byte(r.ID))
-		return err
+		if err := unindexExisting(tx, r.ID); err != nil {
+			return err
+		}
+		return b.Delete([]byte(r.ID))
 	})
 	if err != nil {
 		return false, err
@@ -115,12 +253,34 @@ func (r *Record) Delete() (bool, error) {
 	return true, nil
 }
 
+// unindexExisting removes the stored version of the record from the indexes
+func unindexExisting(tx *bolt.Tx, checksum string) error {
+	v := tx.Bucket([]byte(bucketName)).Get([]byte(checksum))
+	if v == nil {
+		return nil
+	}
+	var existing Record
+	if err := json.Unmarshal(v, &existing); err != nil {
+		return err
+	}
+	return unindexRecord(tx, existing)
+}
+
 // RemoteOK checks to see if a persisted record returns a 200 status code
 func (r Record) RemoteOK() (bool, error) {
+	return r.RemoteOKContext(context.Background())
+}
+
+// RemoteOKContext is RemoteOK, giving up when the context is done
+func (r Record) RemoteOKContext(ctx context.Context) (bool, error) {
 	if r.URL() == "" {
 		return false, errors.New("empty url")
 	}
-	resp, err := http.Get(r.URL())
+	req, err := http.NewRequest(http.MethodGet, r.URL(), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return false, err
 	}
@@ -138,7 +298,22 @@ func (r Record) String() string {
 	return fmt.Sprintf("[%v] %v (%v)", r.Tags(), r.BaseName, humanize.Bytes(uint64(r.FileSize)))
 }
 
-//Persisted returns whether the record is saved in the database
+// Usage returns how often and how recently the record was copied
+func (r Record) Usage() string {
+	if r.Count == 0 {
+		return "never copied"
+	}
+	return fmt.Sprintf("copied %v, last %v", pluralize(r.Count, "time"), humanize.Time(r.CopiedAt))
+}
+
+func pluralize(count int, word string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %v", count, word)
+	}
+	return fmt.Sprintf("%d %vs", count, word)
+}
+
+// Persisted returns whether the record is saved in the database
 func (r Record) Persisted() bool {
 	return r.persisted
 }
@@ -150,6 +325,16 @@ func (r Record) Tags() string {
 	return tags
 }
 
+// TagList breaks the directory down into individual tags
+func (r Record) TagList() (tags []string) {
+	for _, tag := range strings.Split(r.Directory, string(os.PathSeparator)) {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return
+}
+
 // URL returns a publicly-accessible url
 func (r Record) URL() string {
 	u, err := url.Parse(dropboxBaseURL)
@@ -170,62 +355,11 @@ func (r Record) BBCode() string {
 	return fmt.Sprintf("[img]%v[/img]", r.URL())
 }
 
-// Init queues up the database connection
-func Init() (ok bool, err error) {
-	if databasePath == "" {
-		err = errors.New("no database path set")
-		return
-	}
-	if _, err := os.Stat(databaseDir()); os.IsNotExist(err) {
-		os.MkdirAll(databaseDir(), os.ModePerm)
-	}
-	// connect to the database
-	_, err = Connect()
-	if err != nil {
-		return
-	}
-	// initiate the bucket
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(bucketName))
-		return err
-	})
-	defer db.Close()
-	ok = true
-	return
-}
-
-// Connect to the database
-func Connect() (ok bool, err error) {
-	if databasePath == "" {
-		err = errors.New("no database path set")
-		return
+// HTML returns a publicly-accessible html image tag, sized when the dimensions are known
+func (r Record) HTML() string {
+	var size string
+	if r.Width > 0 && r.Height > 0 {
+		size = fmt.Sprintf(" width=\"%d\" height=\"%d\"", r.Width, r.Height)
 	}
-	db, err = bolt.Open(databasePath, 0600, &bolt.Options{Timeout: 1 * time.Second})
-	if err != nil {
-		connected = false
-		return
-	}
-	connected = true
-	ok = true
-	return
-}
-
-// Disconnect from the database connection
-func Disconnect() {
-	if db != nil && connected {
-		db.Close()
-	}
-}
-
-func removeDatabase() (ok bool, err error) {
-	if databasePath == "" {
-		err = errors.New("no database path set")
-		return
-	}
-	err = os.Remove(databasePath)
-	if err != nil {
-		return
-	}
-	ok = true
-	return
+	return fmt.Sprintf("<img src=\"%v\" alt=\"%v\"%v>", html.EscapeString(r.URL()), html.EscapeString(r.BaseName), size)
 }
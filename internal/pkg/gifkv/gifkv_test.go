@@ -1,14 +1,19 @@
 package gifkv
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/httpclient"
 )
 
 func dbPath() string {
@@ -16,6 +21,12 @@ func dbPath() string {
 	return filepath.Join(workingDir, "..", "db", "test.boltdb.db")
 }
 
+func TestMain(m *testing.M) {
+	// lock files go beside the test databases, instead of the home directory
+	lockDir = filepath.Join(filepath.Dir(dbPath()), "locks")
+	os.Exit(m.Run())
+}
+
 func initDbPath() {
 	SetDatabasePath(dbPath())
 }
@@ -156,6 +167,179 @@ func TestGifFind(t *testing.T) {
 	tearDown()
 }
 
+func TestGifEach(t *testing.T) {
+	setUp()
+
+	recordOne := generateRecord("checksum-a", "abcd")
+	recordTwo := generateRecord("checksum-b", "efgh")
+	recordOne.Save()
+	recordTwo.Save()
+
+	var ids []string
+	err := Each(func(r Record) error {
+		assert.True(t, r.Persisted())
+		ids = append(ids, r.ID)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"checksum-a", "checksum-b"}, ids)
+
+	err = Each(func(r Record) error {
+		return errors.New("stop")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, "stop", err.Error())
+
+	tearDown()
+}
+
+func TestGifSearch(t *testing.T) {
+	setUp()
+
+	records := []Record{
+		{ID: "a", BaseName: "shake it off.gif", Directory: "/taylor swift/dancing"},
+		{ID: "b", BaseName: "love story.gif", Directory: "/taylor swift"},
+		{ID: "c", BaseName: "dancing queen.gif", Directory: "/abba"},
+		{ID: "d", BaseName: "bad blood.gif", Directory: "/taylor swift/angry"},
+	}
+	for i := range records {
+		records[i].Save()
+	}
+
+	found, err := Search("dancing")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "a"}, ids(found))
+
+	found, err = Search("TAYLOR story")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, ids(found))
+
+	found, err = Search("tswft")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"d", "b", "a"}, ids(found))
+
+	found, err = Search("reputation")
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+
+	_, err = Search("  ")
+	assert.NotNil(t, err)
+	assert.Equal(t, "no search terms", err.Error())
+
+	tearDown()
+}
+
+func TestFuzzy(t *testing.T) {
+	assert.True(t, fuzzy("shake it off", "sio"))
+	assert.True(t, fuzzy("shake it off", "shake"))
+	assert.True(t, fuzzy("shake it off", ""))
+	assert.False(t, fuzzy("shake it off", "ois"))
+	assert.False(t, fuzzy("shake it off", "shaken"))
+}
+
+func ids(records []Record) (ids []string) {
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	return
+}
+
+func TestGifSaveTimestamps(t *testing.T) {
+	setUp()
+	defer func() { now = time.Now }()
+
+	created := time.Date(2018, 5, 9, 12, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+
+	record := generateRecord("checksum-a", "abcd")
+	now = func() time.Time { return created }
+	record.Save()
+	assert.Equal(t, created, record.CreatedAt)
+	assert.Equal(t, created, record.UpdatedAt)
+
+	now = func() time.Time { return updated }
+	record.Save()
+	found, _ := Find(record.ID)
+	assert.True(t, created.Equal(found.CreatedAt))
+	assert.True(t, updated.Equal(found.UpdatedAt))
+
+	tearDown()
+}
+
+func TestGifCopied(t *testing.T) {
+	setUp()
+	defer func() { now = time.Now }()
+
+	copied := time.Date(2018, 5, 9, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return copied }
+
+	record := generateRecord("checksum-a", "abcd")
+	ok, err := record.Copied()
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	now = func() time.Time { return copied.Add(time.Minute) }
+	record.Copied()
+
+	// copying isn't an update to the link
+	found, _ := Find(record.ID)
+	assert.Equal(t, 2, found.Count)
+	assert.True(t, copied.Add(time.Minute).Equal(found.CopiedAt))
+	assert.True(t, copied.Equal(found.UpdatedAt))
+
+	tearDown()
+}
+
+func TestGifRecentAndTop(t *testing.T) {
+	setUp()
+	defer func() { now = time.Now }()
+
+	start := time.Date(2018, 5, 9, 12, 0, 0, 0, time.UTC)
+	copies := []struct {
+		checksum string
+		times    int
+	}{{"a", 1}, {"b", 3}, {"c", 2}, {"a", 1}}
+	for i, c := range copies {
+		now = func() time.Time { return start.Add(time.Duration(i) * time.Minute) }
+		record, err := Find(c.checksum)
+		if err != nil {
+			record = generateRecord(c.checksum, "")
+		}
+		for j := 0; j < c.times; j++ {
+			record.Copied()
+		}
+	}
+	never := generateRecord("never", "")
+	never.Save()
+
+	recent, err := Recent(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c", "b"}, ids(recent))
+
+	recent, _ = Recent(2)
+	assert.Equal(t, []string{"a", "c"}, ids(recent))
+
+	top, err := Top(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "a", "c"}, ids(top))
+
+	top, _ = Top(1)
+	assert.Equal(t, []string{"b"}, ids(top))
+
+	tearDown()
+}
+
+func TestGifRecordUsage(t *testing.T) {
+	record := generateRecord("1989", "swift")
+	assert.Equal(t, "never copied", record.Usage())
+
+	record.Count = 1
+	record.CopiedAt = time.Now().Add(-2 * time.Hour)
+	assert.Equal(t, "copied 1 time, last 2 hours ago", record.Usage())
+
+	record.Count = 13
+	assert.Equal(t, "copied 13 times, last 2 hours ago", record.Usage())
+}
+
 func TestGifRecordString(t *testing.T) {
 	record := generateRecord("1989", "swift")
 
@@ -176,6 +360,19 @@ func TestGifRecordTags(t *testing.T) {
 	assert.Equal(t, "taylor swift", record.Tags())
 }
 
+func TestGifRecordTagList(t *testing.T) {
+	record := Record{}
+
+	record.Directory = "/taylor swift/love story"
+	assert.Equal(t, []string{"taylor swift", "love story"}, record.TagList())
+
+	record.Directory = "/taylor swift"
+	assert.Equal(t, []string{"taylor swift"}, record.TagList())
+
+	record.Directory = ""
+	assert.Nil(t, record.TagList())
+}
+
 func TestGifRecordURL(t *testing.T) {
 	record := generateRecord("1989", "swift")
 
@@ -199,7 +396,19 @@ func TestGifRecordBBCode(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("[img]%v[/img]", record.URL()), record.BBCode())
 }
 
+func TestGifRecordHTML(t *testing.T) {
+	record := generateRecord("1989", "swift")
+
+	assert.Equal(t, fmt.Sprintf("<img src=\"%v\" alt=\"swiftie life &#39;the best&#39; - 02.gif\">", record.URL()), record.HTML())
+
+	record.Width = 320
+	record.Height = 240
+	assert.Equal(t, fmt.Sprintf("<img src=\"%v\" alt=\"swiftie life &#39;the best&#39; - 02.gif\" width=\"320\" height=\"240\">", record.URL()), record.HTML())
+}
+
 func TestGifRecordRemoteOK(t *testing.T) {
+	defer SetHTTPClient(httpClient)
+	SetHTTPClient(httpclient.New(httpclient.Settings{Timeout: time.Second}))
 	record := generateRecord("1989", "swift")
 
 	// when a valid remote record (200 OK status)
@@ -230,6 +439,50 @@ func TestGifRecordRemoteOK(t *testing.T) {
 	remoteOK, err = record.RemoteOK()
 	assert.False(t, remoteOK)
 	assert.NotNil(t, err)
+
+	// when the check is canceled
+	urlStub = stubValidGif()
+	dropboxBaseURL = urlStub.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	remoteOK, err = record.RemoteOKContext(ctx)
+	assert.False(t, remoteOK)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestSetHTTPClient(t *testing.T) {
+	defer SetHTTPClient(httpClient)
+	record := generateRecord("1989", "swift")
+
+	// without retries, the first answer stands
+	dropboxBaseURL = stubUnavailableGif().URL
+	SetHTTPClient(httpclient.New(httpclient.Settings{Timeout: time.Second}))
+	remoteOK, err := record.RemoteOK()
+	assert.False(t, remoteOK)
+	assert.Nil(t, err)
+
+	// with a retry, the second answer does
+	dropboxBaseURL = stubUnavailableGif().URL
+	SetHTTPClient(httpclient.New(httpclient.Settings{Timeout: time.Second, Retries: 1}))
+	remoteOK, err = record.RemoteOK()
+	assert.True(t, remoteOK)
+	assert.Nil(t, err)
+}
+
+// stubUnavailableGif is unavailable for the first request only
+func stubUnavailableGif() *httptest.Server {
+	var mutex sync.Mutex
+	unavailable := true
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if unavailable {
+			unavailable = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
 }
 
 func stubValidGif() *httptest.Server {
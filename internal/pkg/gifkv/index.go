@@ -0,0 +1,166 @@
+package gifkv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+// index is a secondary-index bucket, mapping each of a record's keys to its checksum
+type index struct {
+	bucket string
+	keys   func(Record) []string
+}
+
+var nameIndex = index{"index_name", func(r Record) []string {
+	return nonEmpty(strings.ToLower(r.BaseName))
+}}
+var tagIndex = index{"index_tag", func(r Record) (keys []string) {
+	for _, tag := range r.TagList() {
+		keys = append(keys, strings.ToLower(tag))
+	}
+	return
+}}
+var sharedLinkIndex = index{"index_shared_link_id", func(r Record) []string {
+	return nonEmpty(r.SharedLinkID)
+}}
+var remotePathIndex = index{"index_remote_path", func(r Record) []string {
+	return nonEmpty(r.RemotePath)
+}}
+
+var indexes = []index{nameIndex, tagIndex, sharedLinkIndex, remotePathIndex}
+
+// keySeparator splits the indexed value from the checksum in an index key
+const keySeparator = "\x00"
+
+// RebuildIndexes regenerates every secondary index from the records, returning
+// the number of records indexed
+func (s *BoltStore) RebuildIndexes() (count int, err error) {
+	err = s.update(func(tx *bolt.Tx) error {
+		count, err = rebuildIndexes(tx)
+		return err
+	})
+	return
+}
+
+func rebuildIndexes(tx *bolt.Tx) (count int, err error) {
+	for _, idx := range indexes {
+		if tx.Bucket([]byte(idx.bucket)) != nil {
+			if err = tx.DeleteBucket([]byte(idx.bucket)); err != nil {
+				return
+			}
+		}
+		if _, err = tx.CreateBucket([]byte(idx.bucket)); err != nil {
+			return
+		}
+	}
+	err = tx.Bucket([]byte(bucketName)).ForEach(func(k, v []byte) error {
+		var record Record
+		if err := json.Unmarshal(v, &record); err != nil {
+			return err
+		}
+		count++
+		return indexRecord(tx, record)
+	})
+	return
+}
+
+// createIndexes makes sure every index bucket exists
+func createIndexes(tx *bolt.Tx) (err error) {
+	for _, idx := range indexes {
+		if _, err = tx.CreateBucketIfNotExists([]byte(idx.bucket)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func indexRecord(tx *bolt.Tx, r Record) error {
+	for _, idx := range indexes {
+		b := tx.Bucket([]byte(idx.bucket))
+		for _, key := range idx.keys(r) {
+			if err := b.Put(indexKey(key, r.ID), []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func unindexRecord(tx *bolt.Tx, r Record) error {
+	for _, idx := range indexes {
+		b := tx.Bucket([]byte(idx.bucket))
+		for _, key := range idx.keys(r) {
+			if err := b.Delete(indexKey(key, r.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookup returns the records with the key in the index, in checksum order.
+// Stores without indexes are scanned instead.
+func lookup(s Store, idx index, key string) (records []Record, err error) {
+	if b, ok := local(s).(*BoltStore); ok {
+		return b.lookup(idx, key)
+	}
+	err = s.Iterate(func(r Record) error {
+		for _, k := range idx.keys(r) {
+			if k == key {
+				records = append(records, r)
+				break
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (s *BoltStore) lookup(idx index, key string) (records []Record, err error) {
+	err = s.view(func(tx *bolt.Tx) error {
+		gifs := tx.Bucket([]byte(bucketName))
+		prefix := indexKey(key, "")
+		c := tx.Bucket([]byte(idx.bucket)).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			v := gifs.Get(k[len(prefix):])
+			if v == nil {
+				continue
+			}
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			record.persisted = true
+			records = append(records, record)
+		}
+		return nil
+	})
+	return
+}
+
+func first(s Store, idx index, key string, description string) (record Record, err error) {
+	records, err := lookup(s, idx, key)
+	if err != nil {
+		return
+	}
+	if len(records) == 0 {
+		err = fmt.Errorf("Unable to find %v \"%s\"", description, key)
+		return
+	}
+	return records[0], nil
+}
+
+func indexKey(key string, checksum string) []byte {
+	return []byte(key + keySeparator + checksum)
+}
+
+func nonEmpty(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return []string{key}
+}
@@ -0,0 +1,150 @@
+package gifkv
+
+import (
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/assert"
+)
+
+func indexedRecords() []Record {
+	return []Record{
+		{ID: "a", BaseName: "Shake It Off.gif", Directory: "/taylor swift/dancing", SharedLinkID: "link-a", RemotePath: "/s/aaa"},
+		{ID: "b", BaseName: "love story.gif", Directory: "/taylor swift", SharedLinkID: "link-b", RemotePath: "/s/bbb"},
+		{ID: "c", BaseName: "shake it off.gif", Directory: "/covers/Dancing", SharedLinkID: "link-c", RemotePath: "/s/ccc"},
+	}
+}
+
+func TestFindByName(t *testing.T) {
+	setUp()
+	for _, r := range indexedRecords() {
+		r.Save()
+	}
+
+	found, err := FindByName("SHAKE IT OFF.gif")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, ids(found))
+	assert.True(t, found[0].Persisted())
+
+	found, err = FindByName("shake it")
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+
+	tearDown()
+}
+
+func TestFindByTag(t *testing.T) {
+	setUp()
+	for _, r := range indexedRecords() {
+		r.Save()
+	}
+
+	found, err := FindByTag("dancing")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, ids(found))
+
+	found, err = FindByTag("Taylor Swift")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids(found))
+
+	found, err = FindByTag("taylor")
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+
+	tearDown()
+}
+
+func TestFindBySharedLinkID(t *testing.T) {
+	setUp()
+	for _, r := range indexedRecords() {
+		r.Save()
+	}
+
+	record, err := FindBySharedLinkID("link-b")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", record.ID)
+
+	_, err = FindBySharedLinkID("link-z")
+	assert.NotNil(t, err)
+	assert.Equal(t, "Unable to find shared link id \"link-z\"", err.Error())
+
+	tearDown()
+}
+
+func TestFindByRemotePath(t *testing.T) {
+	setUp()
+	for _, r := range indexedRecords() {
+		r.Save()
+	}
+
+	record, err := FindByRemotePath("/s/ccc")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", record.ID)
+
+	_, err = FindByRemotePath("/s/zzz")
+	assert.NotNil(t, err)
+	assert.Equal(t, "Unable to find remote path \"/s/zzz\"", err.Error())
+
+	tearDown()
+}
+
+func TestIndexesFollowSaveAndDelete(t *testing.T) {
+	setUp()
+
+	record := indexedRecords()[0]
+	record.Save()
+
+	// moving the gif re-indexes it under its new tags
+	record.Directory = "/reputation"
+	record.SharedLinkID = "link-new"
+	record.Save()
+
+	found, _ := FindByTag("dancing")
+	assert.Empty(t, found)
+	found, _ = FindByTag("reputation")
+	assert.Equal(t, []string{"a"}, ids(found))
+	_, err := FindBySharedLinkID("link-a")
+	assert.NotNil(t, err)
+	_, err = FindBySharedLinkID("link-new")
+	assert.Nil(t, err)
+
+	record.Delete()
+	found, _ = FindByName("shake it off.gif")
+	assert.Empty(t, found)
+	found, _ = FindByTag("reputation")
+	assert.Empty(t, found)
+
+	tearDown()
+}
+
+func TestRebuildIndexes(t *testing.T) {
+	setUp()
+	for _, r := range indexedRecords() {
+		r.Save()
+	}
+
+	// simulate a database from before the indexes existed
+	defaultStore.(*BoltStore).db.Update(func(tx *bolt.Tx) error {
+		for _, idx := range indexes {
+			tx.DeleteBucket([]byte(idx.bucket))
+		}
+		return tx.Bucket([]byte(metaBucketName)).Put([]byte(schemaVersionKey), []byte("1"))
+	})
+	Disconnect()
+	ok, err := Init()
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	Connect()
+
+	found, err := FindByTag("dancing")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, ids(found))
+
+	count, err := RebuildIndexes()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	found, _ = FindByName("love story.gif")
+	assert.Equal(t, []string{"b"}, ids(found))
+
+	tearDown()
+}
@@ -0,0 +1,212 @@
+package gifkv
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// JSONStore keeps the records in a plain JSON file, which syncs well in a
+// Dropbox folder. Every change rewrites the whole file, replacing it at once
+// so a reader never sees half of it. Changes are made while holding a lock
+// file, on top of whatever another process last wrote. The lock only keeps out
+// other processes on the same machine.
+type JSONStore struct {
+	*MemoryStore
+	path     string
+	readOnly bool
+	options  Options
+	writing  sync.Mutex
+}
+
+// lockDir holds the lock files, outside of the Dropbox folder so they aren't
+// copied to other machines, where they would only get in the way
+var lockDir = "~/.dgl/locks"
+
+// staleLock is how old a lock file gets before it's taken to be left behind
+// by a process that crashed
+var staleLock = 30 * time.Second
+
+// jsonFile is the layout of the JSON file
+type jsonFile struct {
+	Version int      `json:"version"`
+	Records []Record `json:"records"`
+}
+
+// OpenJSON loads the JSON file at path, creating it unless it is opened read-only
+func OpenJSON(path string, options Options) (s *JSONStore, err error) {
+	if path == "" {
+		return nil, errors.New("no database path set")
+	}
+	s = &JSONStore{MemoryStore: NewMemoryStore(), path: path, readOnly: options.ReadOnly, options: options}
+	file, err := readJSONFile(path)
+	if os.IsNotExist(err) {
+		if options.ReadOnly {
+			return nil, fmt.Errorf("the database %v has not been created yet", path)
+		}
+		if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return nil, err
+		}
+		return s, s.change(func() {})
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.MemoryStore.putAll(file.Records)
+	return s, nil
+}
+
+// readJSONFile reads the JSON file at path, as long as its schema is supported
+func readJSONFile(path string) (file jsonFile, err error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(raw, &file); err != nil {
+		return file, fmt.Errorf("unable to read %v: %v", path, err)
+	}
+	if file.Version > SchemaVersion() {
+		return file, fmt.Errorf("the database schema version %d is newer than this version supports (%d)", file.Version, SchemaVersion())
+	}
+	return
+}
+
+// Path returns the JSON file path
+func (s *JSONStore) Path() string {
+	return s.path
+}
+
+// ReadOnly returns whether the store was opened read-only
+func (s *JSONStore) ReadOnly() bool {
+	return s.readOnly
+}
+
+// Save captures the record and rewrites the file
+func (s *JSONStore) Save(r *Record) (bool, error) {
+	if err := s.change(func() { s.MemoryStore.Save(r) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete removes the record and rewrites the file
+func (s *JSONStore) Delete(r *Record) (bool, error) {
+	if err := s.change(func() { s.MemoryStore.Delete(r) }); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// putAll saves the records as-is and rewrites the file once
+func (s *JSONStore) putAll(records []Record) error {
+	return s.change(func() { s.MemoryStore.putAll(records) })
+}
+
+// change makes the change on top of the records in the file, then rewrites it,
+// holding the lock file so no other process changes it in between
+func (s *JSONStore) change(apply func()) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	s.writing.Lock()
+	defer s.writing.Unlock()
+	lock, err := s.lockPath()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockFile(lock, s.options)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	file, err := readJSONFile(s.path)
+	if err == nil {
+		s.MemoryStore.replace(file.Records)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	apply()
+	return s.write()
+}
+
+// lockPath returns the lock file for the JSON file, named after its full path
+func (s *JSONStore) lockPath() (path string, err error) {
+	dir, err := homedir.Expand(lockDir)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	full, err := filepath.Abs(s.path)
+	if err != nil {
+		return
+	}
+	return filepath.Join(dir, fmt.Sprintf("%v-%x.lock", filepath.Base(full), sha1.Sum([]byte(full)))), nil
+}
+
+// lockFile creates the lock file at path, backing off while another process
+// holds it, and returns how to let go of it. A stale lock file is taken over.
+func lockFile(path string, options Options) (unlock func(), err error) {
+	backoff := options.Backoff
+	for attempt := 0; ; attempt++ {
+		var file *os.File
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > staleLock && os.Remove(path) == nil {
+			continue
+		}
+		if attempt >= options.Retries {
+			return nil, fmt.Errorf("%w (%v)", ErrLocked, path)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// write replaces the file with the current records
+func (s *JSONStore) write() error {
+	file := jsonFile{Version: SchemaVersion(), Records: s.snapshot()}
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(s.path, append(raw, '\n'))
+}
+
+// writeFile replaces the file at path with the data all at once, by writing
+// to a temporary file beside it first
+func writeFile(path string, data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err = temp.Write(data); err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0600)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,111 @@
+package gifkv
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps the records in memory, which is handy for tests
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	records map[string]Record
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Find looks up a record by checksum
+func (s *MemoryStore) Find(checksum string) (record Record, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	record, ok := s.records[checksum]
+	if !ok {
+		err = fmt.Errorf("Unable to find id \"%s\"", checksum)
+		return
+	}
+	record.persisted = true
+	return
+}
+
+// Save captures the record
+func (s *MemoryStore) Save(r *Record) (bool, error) {
+	r.touch()
+	r.Version = SchemaVersion()
+	s.putAll([]Record{*r})
+	r.persisted = true
+	return true, nil
+}
+
+// Delete removes the record
+func (s *MemoryStore) Delete(r *Record) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.records, r.ID)
+	r.persisted = false
+	return true, nil
+}
+
+// Count returns the number of records
+func (s *MemoryStore) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.records)
+}
+
+// Iterate calls fn with every record in checksum order, stopping at the first error.
+// It works from a snapshot, so fn is free to change the store.
+func (s *MemoryStore) Iterate(fn func(Record) error) error {
+	for _, record := range s.snapshot() {
+		record.persisted = true
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close does nothing, as there is nothing to release
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// putAll saves the records as-is, leaving the timestamps alone
+func (s *MemoryStore) putAll(records []Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, record := range records {
+		record.Version = SchemaVersion()
+		record.persisted = false
+		s.records[record.ID] = record
+	}
+	return nil
+}
+
+// replace swaps every record for the ones given, as-is
+func (s *MemoryStore) replace(records []Record) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records = make(map[string]Record, len(records))
+	for _, record := range records {
+		record.Version = SchemaVersion()
+		record.persisted = false
+		s.records[record.ID] = record
+	}
+}
+
+// snapshot returns every record in checksum order
+func (s *MemoryStore) snapshot() (records []Record) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	records = make([]Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	return
+}
@@ -0,0 +1,164 @@
+package gifkv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+var metaBucketName = "meta"
+var schemaVersionKey = "schema_version"
+
+// errDryRun rolls back a migration transaction that was only a rehearsal
+var errDryRun = errors.New("dry run")
+
+// migration upgrades the database by a single schema version. Records are
+// migrated as raw JSON, so fields can be renamed or reshaped safely.
+type migration struct {
+	version     int
+	description string
+	record      func(raw map[string]interface{}) (changed bool)
+	tx          func(tx *bolt.Tx) (changed int, err error)
+}
+
+var migrations = []migration{
+	{
+		version:     1,
+		description: "stamp each record with its format version",
+		record: func(raw map[string]interface{}) bool {
+			_, versioned := raw["version"]
+			return !versioned
+		},
+	},
+	{
+		version:     2,
+		description: "index each record by name, tags, shared link id, and remote path",
+		tx:          rebuildIndexes,
+	},
+}
+
+// MigrationStep describes a single migration that was, or would be, applied
+type MigrationStep struct {
+	Version     int
+	Description string
+	Changed     int
+}
+
+// MigrationReport describes the migrations that were, or would be, applied
+type MigrationReport struct {
+	From  int
+	To    int
+	Steps []MigrationStep
+}
+
+// String returns a summary of the report
+func (m MigrationReport) String() string {
+	if len(m.Steps) == 0 {
+		return fmt.Sprintf("Schema version %d is up to date", m.From)
+	}
+	output := fmt.Sprintf("Schema version %d -> %d", m.From, m.To)
+	for _, step := range m.Steps {
+		output += fmt.Sprintf("\n %d. %v (%v changed)", step.Version, step.Description, pluralize(step.Changed, "record"))
+	}
+	return output
+}
+
+// SchemaVersion returns the latest schema version supported
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate upgrades the database one schema version at a time. A dry run
+// reports what would change without writing anything.
+func (s *BoltStore) Migrate(dryRun bool) (report MigrationReport, err error) {
+	err = s.update(func(tx *bolt.Tx) error {
+		report = MigrationReport{}
+		meta, err := tx.CreateBucketIfNotExists([]byte(metaBucketName))
+		if err != nil {
+			return err
+		}
+		report.From, err = storedVersion(meta)
+		if err != nil {
+			return err
+		}
+		if report.From > SchemaVersion() {
+			return fmt.Errorf("the database schema version %d is newer than this version supports (%d)", report.From, SchemaVersion())
+		}
+		report.To = report.From
+		for _, m := range migrations {
+			if m.version <= report.From {
+				continue
+			}
+			step := MigrationStep{Version: m.version, Description: m.description}
+			step.Changed, err = m.apply(tx)
+			if err != nil {
+				return fmt.Errorf("migration %d failed: %v", m.version, err)
+			}
+			report.Steps = append(report.Steps, step)
+			report.To = m.version
+		}
+		if err = meta.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(report.To))); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	return
+}
+
+// apply runs the migration, stamping every record with its version
+func (m migration) apply(tx *bolt.Tx) (changed int, err error) {
+	if m.tx != nil {
+		if changed, err = m.tx(tx); err != nil {
+			return
+		}
+	}
+	b := tx.Bucket([]byte(bucketName))
+	updates := make(map[string][]byte)
+	err = b.ForEach(func(k, v []byte) error {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(v, &raw); err != nil {
+			return fmt.Errorf("record %s: %v", k, err)
+		}
+		if m.record != nil && m.record(raw) {
+			changed++
+		}
+		raw["version"] = m.version
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		updates[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	// bolt does not allow writes while iterating
+	for k, v := range updates {
+		if err = b.Put([]byte(k), v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func storedVersion(meta *bolt.Bucket) (int, error) {
+	v := meta.Get([]byte(schemaVersionKey))
+	if v == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q", v)
+	}
+	return version, nil
+}
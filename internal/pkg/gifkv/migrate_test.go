@@ -0,0 +1,90 @@
+package gifkv
+
+import (
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/assert"
+)
+
+// legacySetUp creates a database as it was before records were versioned
+func legacySetUp() {
+	initDbPath()
+	removeDatabase()
+	Connect()
+	defaultStore.(*BoltStore).db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte(bucketName))
+		b.Put([]byte("a"), []byte(`{"checksum":"a","base_name":"shake it off.gif","directory":"/taylor swift","file_size":3456,"shared_link_id":"link-a","remote_path":"/s/aaa"}`))
+		b.Put([]byte("b"), []byte(`{"checksum":"b","base_name":"love story.gif","directory":"/taylor swift","file_size":4567,"shared_link_id":"link-b","remote_path":"/s/bbb"}`))
+		return nil
+	})
+	Disconnect()
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	legacySetUp()
+	ok, err := InitWithoutMigrations()
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	Connect()
+
+	report, err := Migrate(true)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, report.From)
+	assert.Equal(t, SchemaVersion(), report.To)
+	assert.Equal(t, []MigrationStep{
+		{1, "stamp each record with its format version", 2},
+		{2, "index each record by name, tags, shared link id, and remote path", 2},
+	}, report.Steps)
+
+	// nothing was written
+	record, _ := Find("a")
+	assert.Equal(t, 0, record.Version)
+	found, _ := FindByTag("taylor swift")
+	assert.Empty(t, found)
+	report, _ = Migrate(true)
+	assert.Equal(t, 0, report.From)
+
+	tearDown()
+}
+
+func TestMigrate(t *testing.T) {
+	legacySetUp()
+	ok, err := Init()
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	Connect()
+
+	record, err := Find("a")
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion(), record.Version)
+	assert.Equal(t, "shake it off.gif", record.BaseName)
+	found, _ := FindByTag("taylor swift")
+	assert.Equal(t, []string{"a", "b"}, ids(found))
+
+	report, err := Migrate(false)
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion(), report.From)
+	assert.Empty(t, report.Steps)
+	assert.Equal(t, "Schema version 2 is up to date", report.String())
+
+	tearDown()
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	setUp()
+	defaultStore.(*BoltStore).db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(metaBucketName)).Put([]byte(schemaVersionKey), []byte("99"))
+	})
+
+	_, err := Migrate(false)
+	assert.NotNil(t, err)
+	assert.Equal(t, "the database schema version 99 is newer than this version supports (2)", err.Error())
+
+	tearDown()
+}
+
+func TestMigrationReportString(t *testing.T) {
+	report := MigrationReport{From: 0, To: 2, Steps: []MigrationStep{{1, "first", 1}, {2, "second", 0}}}
+	assert.Equal(t, "Schema version 0 -> 2\n 1. first (1 record changed)\n 2. second (0 records changed)", report.String())
+}
@@ -0,0 +1,82 @@
+package gifkv
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Store keeps the gif records
+type Store interface {
+	// Find looks up a record by checksum
+	Find(checksum string) (Record, error)
+	// Save captures the record, stamping when it was created and updated
+	Save(r *Record) (bool, error)
+	// Delete removes the record
+	Delete(r *Record) (bool, error)
+	// Count returns the number of records
+	Count() int
+	// Iterate calls fn with every record in checksum order, stopping at the first error
+	Iterate(fn func(Record) error) error
+	// Close releases the store
+	Close() error
+}
+
+// Storage types
+const (
+	// BoltStorage keeps the records in a bolt database
+	BoltStorage = "bolt"
+	// JSONStorage keeps the records in a plain JSON file
+	JSONStorage = "json"
+)
+
+// ErrLocked is returned when another process holds the database open for writing
+var ErrLocked = errors.New("the database is in use by another process")
+
+// ErrReadOnly is returned when writing to a store opened in read-only mode
+var ErrReadOnly = errors.New("the database was opened read-only")
+
+var errNotConnected = errors.New("not connected to the database")
+
+// Options configure how a store is opened
+type Options struct {
+	// Storage is the type of store to open, defaulting to BoltStorage
+	Storage string
+	// ReadOnly opens the database without taking the write lock, so any number
+	// of readers can share it
+	ReadOnly bool
+	// Timeout is how long each attempt waits for the lock
+	Timeout time.Duration
+	// Retries is how many more attempts are made when the database is locked
+	Retries int
+	// Backoff is the pause before the first retry, doubling with each one
+	Backoff time.Duration
+}
+
+// DefaultOptions wait a few seconds for another process to let go of the database
+var DefaultOptions = Options{
+	Timeout: 250 * time.Millisecond,
+	Retries: 4,
+	Backoff: 250 * time.Millisecond,
+}
+
+// Open opens the store at path using the storage type in the options
+func Open(path string, options Options) (Store, error) {
+	switch options.Storage {
+	case "", BoltStorage:
+		return OpenBolt(path, options)
+	case JSONStorage:
+		return OpenJSON(path, options)
+	}
+	return nil, fmt.Errorf("unsupported storage [%v]", options.Storage)
+}
+
+// disconnected stands in for the default store until Connect is called
+type disconnected struct{}
+
+func (disconnected) Find(string) (Record, error)      { return Record{}, errNotConnected }
+func (disconnected) Save(*Record) (bool, error)       { return false, errNotConnected }
+func (disconnected) Delete(*Record) (bool, error)     { return false, errNotConnected }
+func (disconnected) Count() int                       { return 0 }
+func (disconnected) Iterate(func(Record) error) error { return errNotConnected }
+func (disconnected) Close() error                     { return nil }
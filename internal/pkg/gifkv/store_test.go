@@ -0,0 +1,364 @@
+package gifkv
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var impatient = Options{Timeout: 20 * time.Millisecond, Retries: 1, Backoff: 10 * time.Millisecond}
+
+func TestOpen(t *testing.T) {
+	initDbPath()
+	removeDatabase()
+
+	_, err := OpenBolt("", DefaultOptions)
+	assert.NotNil(t, err)
+	assert.Equal(t, "no database path set", err.Error())
+
+	_, err = OpenBolt(dbPath(), Options{ReadOnly: true})
+	assert.NotNil(t, err)
+	assert.Equal(t, "the database "+dbPath()+" has not been created yet", err.Error())
+
+	s, err := OpenBolt(dbPath(), DefaultOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, dbPath(), s.Path())
+	assert.False(t, s.ReadOnly())
+	record := generateRecord("checksum-a", "abcd")
+	ok, err := s.Save(&record)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Close())
+	assert.Nil(t, s.Close())
+
+	_, err = s.Find("checksum-a")
+	assert.Equal(t, errNotConnected, err)
+
+	removeDatabase()
+}
+
+func TestOpenLocked(t *testing.T) {
+	initDbPath()
+	removeDatabase()
+
+	writer, err := OpenBolt(dbPath(), DefaultOptions)
+	assert.Nil(t, err)
+
+	_, err = OpenBolt(dbPath(), impatient)
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Equal(t, "the database is in use by another process ("+dbPath()+")", err.Error())
+
+	readOnly := impatient
+	readOnly.ReadOnly = true
+	_, err = OpenBolt(dbPath(), readOnly)
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		writer.Close()
+	}()
+	patient := Options{Timeout: 20 * time.Millisecond, Retries: 5, Backoff: 20 * time.Millisecond}
+	s, err := OpenBolt(dbPath(), patient)
+	assert.Nil(t, err)
+	s.Close()
+
+	removeDatabase()
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	setUp()
+	record := generateRecord("checksum-a", "abcd")
+	record.Save()
+	Disconnect()
+
+	readOnly := DefaultOptions
+	readOnly.ReadOnly = true
+	first, err := OpenBolt(dbPath(), readOnly)
+	assert.Nil(t, err)
+	second, err := OpenBolt(dbPath(), readOnly)
+	assert.Nil(t, err)
+	assert.True(t, second.ReadOnly())
+
+	found, err := first.Find("checksum-a")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, second.Count())
+
+	ok, err := copied(second, &found)
+	assert.False(t, ok)
+	assert.Equal(t, ErrReadOnly, err)
+	_, err = second.Delete(&found)
+	assert.Equal(t, ErrReadOnly, err)
+
+	first.Close()
+	second.Close()
+	tearDown()
+}
+
+func TestConnectReadOnly(t *testing.T) {
+	setUp()
+	Disconnect()
+
+	ok, err := ConnectReadOnly()
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	record := generateRecord("checksum-a", "abcd")
+	_, err = record.Save()
+	assert.Equal(t, ErrReadOnly, err)
+
+	ok, err = Connect()
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	_, err = record.Save()
+	assert.Nil(t, err)
+
+	Disconnect()
+	_, err = Find("checksum-a")
+	assert.Equal(t, errNotConnected, err)
+
+	tearDown()
+}
+
+// eachStore runs the test against an empty store of every type
+func eachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	jsonPath := filepath.Join(filepath.Dir(dbPath()), "test.json")
+	openers := map[string]func() (Store, error){
+		"bolt":   func() (Store, error) { removeDatabase(); return OpenBolt(dbPath(), DefaultOptions) },
+		"json":   func() (Store, error) { os.Remove(jsonPath); return OpenJSON(jsonPath, DefaultOptions) },
+		"memory": func() (Store, error) { return NewMemoryStore(), nil },
+	}
+	initDbPath()
+	for name, open := range openers {
+		t.Run(name, func(t *testing.T) {
+			s, err := open()
+			assert.Nil(t, err)
+			test(t, s)
+			s.Close()
+		})
+	}
+	removeDatabase()
+	os.Remove(jsonPath)
+}
+
+func TestStoreSaveFindDelete(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		record := generateRecord("checksum-a", "abcd")
+		ok, err := s.Save(&record)
+		assert.True(t, ok)
+		assert.Nil(t, err)
+		assert.True(t, record.Persisted())
+		assert.False(t, record.CreatedAt.IsZero())
+		assert.Equal(t, SchemaVersion(), record.Version)
+		assert.Equal(t, 1, s.Count())
+
+		found, err := s.Find("checksum-a")
+		assert.Nil(t, err)
+		assert.True(t, found.Persisted())
+		assert.Equal(t, record.BaseName, found.BaseName)
+		assert.True(t, record.CreatedAt.Equal(found.CreatedAt))
+
+		ok, err = s.Delete(&found)
+		assert.True(t, ok)
+		assert.Nil(t, err)
+		assert.False(t, found.Persisted())
+		assert.Equal(t, 0, s.Count())
+
+		_, err = s.Find("checksum-a")
+		assert.NotNil(t, err)
+		assert.Equal(t, "Unable to find id \"checksum-a\"", err.Error())
+	})
+}
+
+func TestStoreIterate(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		for _, id := range []string{"checksum-c", "checksum-a", "checksum-b"} {
+			record := generateRecord(id, id)
+			s.Save(&record)
+		}
+
+		var seen []string
+		err := s.Iterate(func(r Record) error {
+			seen = append(seen, r.ID)
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"checksum-a", "checksum-b", "checksum-c"}, seen)
+
+		err = s.Iterate(func(r Record) error {
+			return errors.New("stop")
+		})
+		assert.Equal(t, "stop", err.Error())
+	})
+}
+
+func TestStoreQueries(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		recordOne := generateRecord("checksum-a", "abcd")
+		recordTwo := generateRecord("checksum-b", "efgh")
+		recordTwo.BaseName = "shake it off.gif"
+		s.Save(&recordOne)
+		s.Save(&recordTwo)
+		copied(s, &recordTwo)
+
+		records, err := search(s, "shake")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"checksum-b"}, ids(records))
+
+		records, err = top(s, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"checksum-b"}, ids(records))
+
+		records, err = lookup(s, tagIndex, "taylor swift")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"checksum-a", "checksum-b"}, ids(records))
+
+		record, err := first(s, sharedLinkIndex, "efgh", "shared link id")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, record.Count)
+	})
+}
+
+func TestStoreImportRecords(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		existing := generateRecord("checksum-a", "abcd")
+		s.Save(&existing)
+
+		incoming := []Record{generateRecord("checksum-a", "efgh"), generateRecord("checksum-b", "ijkl")}
+		incoming[0].UpdatedAt = existing.UpdatedAt.Add(time.Hour)
+		report, err := importRecords(s, incoming, Merge)
+		assert.Nil(t, err)
+		assert.Equal(t, ImportReport{Added: 1, Updated: 1}, report)
+
+		record, _ := s.Find("checksum-a")
+		assert.Equal(t, "efgh", record.SharedLinkID)
+		assert.True(t, incoming[0].UpdatedAt.Equal(record.UpdatedAt))
+		assert.Equal(t, 2, s.Count())
+	})
+}
+
+func TestOpenJSON(t *testing.T) {
+	path := filepath.Join(filepath.Dir(dbPath()), "test.json")
+	os.Remove(path)
+
+	_, err := OpenJSON(path, Options{ReadOnly: true})
+	assert.NotNil(t, err)
+	assert.Equal(t, "the database "+path+" has not been created yet", err.Error())
+
+	s, err := OpenJSON(path, DefaultOptions)
+	assert.Nil(t, err)
+	record := generateRecord("checksum-a", "abcd")
+	s.Save(&record)
+	s.Close()
+
+	raw, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(raw), "\"version\": 2,\n  \"records\": [\n    {\n      \"checksum\": \"checksum-a\",")
+
+	readOnly, err := Open(path, Options{Storage: JSONStorage, ReadOnly: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, readOnly.Count())
+	_, err = readOnly.Save(&record)
+	assert.Equal(t, ErrReadOnly, err)
+	_, err = readOnly.Delete(&record)
+	assert.Equal(t, ErrReadOnly, err)
+
+	ioutil.WriteFile(path, []byte(`{"version": 99, "records": []}`), 0600)
+	_, err = OpenJSON(path, DefaultOptions)
+	assert.NotNil(t, err)
+	assert.Equal(t, "the database schema version 99 is newer than this version supports (2)", err.Error())
+
+	ioutil.WriteFile(path, []byte(`not json`), 0600)
+	_, err = OpenJSON(path, DefaultOptions)
+	assert.NotNil(t, err)
+
+	_, err = Open(path, Options{Storage: "sqlite"})
+	assert.NotNil(t, err)
+	assert.Equal(t, "unsupported storage [sqlite]", err.Error())
+
+	os.Remove(path)
+}
+
+func TestJSONStoreSharedFile(t *testing.T) {
+	path := filepath.Join(filepath.Dir(dbPath()), "shared.json")
+	defer os.Remove(path)
+	os.Remove(path)
+	locks, _ := ioutil.TempDir("", "gifkv-locks")
+	defer func(dir string) {
+		lockDir = dir
+		os.RemoveAll(locks)
+	}(lockDir)
+	lockDir = locks
+
+	// two processes with the same file keep each other's changes
+	first, err := OpenJSON(path, DefaultOptions)
+	assert.Nil(t, err)
+	second, err := OpenJSON(path, DefaultOptions)
+	assert.Nil(t, err)
+	a := generateRecord("checksum-a", "abcd")
+	b := generateRecord("checksum-b", "efgh")
+	first.Save(&a)
+	second.Save(&b)
+	_, err = first.Delete(&b)
+	assert.Nil(t, err)
+	reopened, _ := OpenJSON(path, Options{ReadOnly: true})
+	assert.Equal(t, 1, reopened.Count())
+	_, err = reopened.Find("checksum-a")
+	assert.Nil(t, err)
+
+	// the lock file is kept out of the file's folder
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.lock"))
+	assert.Empty(t, matches)
+
+	// a change waits for the lock file, then gives up
+	lock, err := first.lockPath()
+	assert.Nil(t, err)
+	assert.Equal(t, locks, filepath.Dir(lock))
+	ioutil.WriteFile(lock, nil, 0600)
+	defer os.Remove(lock)
+	impatient, _ := OpenJSON(path, Options{Retries: 1, Backoff: time.Millisecond})
+	_, err = impatient.Save(&b)
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	// unless the lock file was left behind long ago
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(lock, old, old)
+	_, err = impatient.Save(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, impatient.Count())
+	_, err = os.Stat(lock)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSetStorage(t *testing.T) {
+	ok, err := SetStorage("sqlite")
+	assert.False(t, ok)
+	assert.Equal(t, "unsupported storage [sqlite]", err.Error())
+	assert.Equal(t, BoltStorage, GetStorage())
+
+	jsonPath := filepath.Join(filepath.Dir(dbPath()), "test.json")
+	SetDatabasePath(jsonPath)
+	SetStorage(JSONStorage)
+	ok, err = Init()
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	Connect()
+	record := generateRecord("checksum-a", "abcd")
+	record.Save()
+	assert.Equal(t, 1, Count())
+	_, err = RebuildIndexes()
+	assert.Equal(t, "the json storage does not keep indexes", err.Error())
+	report, err := Migrate(false)
+	assert.Nil(t, err)
+	assert.Equal(t, "Schema version 2 is up to date", report.String())
+	Disconnect()
+
+	_, err = Find("checksum-a")
+	assert.Equal(t, errNotConnected, err)
+
+	SetStorage(BoltStorage)
+	os.Remove(jsonPath)
+}
@@ -0,0 +1,412 @@
+package gifkv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncConfig describes how a local database is kept in sync with other machines
+type SyncConfig struct {
+	// Dir is the shared folder holding every machine's change log
+	Dir string
+	// Machine names this machine's change log
+	Machine string
+	// Shared is the database that lived in the shared folder before syncing.
+	// It seeds an empty local database, and its conflicted copies are merged.
+	Shared string
+	// State is the file remembering how far this machine has synced. It defaults
+	// to sync.json beside the database.
+	State string
+}
+
+// change operations
+const (
+	putChange    = "put"
+	deleteChange = "delete"
+)
+
+// Change is an entry in a machine's change log
+type Change struct {
+	Op      string    `json:"op"`
+	Record  Record    `json:"record"`
+	At      time.Time `json:"at"`
+	Machine string    `json:"machine"`
+}
+
+// SyncReport counts what a sync did
+type SyncReport struct {
+	// Seeded is the number of records copied from the shared database
+	Seeded int
+	// Applied is the number of changes from the change logs applied locally
+	Applied int
+	// Ignored is the number of changes that lost to newer local versions
+	Ignored int
+	// Merged lists the conflicted copies that were merged
+	Merged []string
+}
+
+// String returns a summary of the report
+func (r SyncReport) String() string {
+	output := fmt.Sprintf("%v applied, %v ignored", pluralize(r.Applied, "change"), r.Ignored)
+	if r.Seeded > 0 {
+		output = fmt.Sprintf("%v seeded, %v", pluralize(r.Seeded, "record"), output)
+	}
+	for _, merged := range r.Merged {
+		output += fmt.Sprintf("\nMerged %v", merged)
+	}
+	return output
+}
+
+// syncState remembers how far each change log has been applied, and when
+// records were deleted, so older changes to them are ignored
+type syncState struct {
+	Offsets map[string]int64     `json:"offsets"`
+	Deleted map[string]time.Time `json:"deleted"`
+}
+
+// SyncStore keeps a local store, recording every change to it in this
+// machine's change log and applying the changes from every other log.
+// Conflicting changes to a record are settled by the last writer winning.
+type SyncStore struct {
+	Store
+	config    SyncConfig
+	statePath string
+	state     syncState
+	// pulled counts the changes applied by pulls since the last sync
+	pulled SyncReport
+	// mutex keeps the local store, the change log, and the sync state in step
+	// when changes are made at once
+	mutex sync.Mutex
+}
+
+var unsafeMachineName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// NewSyncStore wraps the local store, keeping its sync state in the statePath file
+func NewSyncStore(local Store, config SyncConfig, statePath string) (s *SyncStore, err error) {
+	if config.Dir == "" || config.Machine == "" {
+		return nil, errors.New("syncing needs a directory and a machine name")
+	}
+	config.Machine = unsafeMachineName.ReplaceAllString(config.Machine, "-")
+	s = &SyncStore{Store: local, config: config, statePath: statePath}
+	s.state = syncState{Offsets: make(map[string]int64), Deleted: make(map[string]time.Time)}
+	raw, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(raw, &s.state); err != nil {
+		return nil, fmt.Errorf("unable to read %v: %v", statePath, err)
+	}
+	if s.state.Offsets == nil {
+		s.state.Offsets = make(map[string]int64)
+	}
+	if s.state.Deleted == nil {
+		s.state.Deleted = make(map[string]time.Time)
+	}
+	return s, nil
+}
+
+// local returns the store a sync store keeps locally, or the store itself
+func local(s Store) Store {
+	if synced, ok := s.(*SyncStore); ok {
+		return synced.Store
+	}
+	return s
+}
+
+// Save captures the record locally and logs the change
+func (s *SyncStore) Save(r *Record) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ok, err := s.Store.Save(r)
+	if err != nil {
+		return ok, err
+	}
+	return ok, s.record(Change{Op: putChange, Record: *r, At: r.UpdatedAt})
+}
+
+// Delete removes the record locally and logs the change
+func (s *SyncStore) Delete(r *Record) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ok, err := s.Store.Delete(r)
+	if err != nil {
+		return ok, err
+	}
+	deleted := now()
+	s.state.Deleted[r.ID] = deleted
+	return ok, s.record(Change{Op: deleteChange, Record: Record{ID: r.ID}, At: deleted})
+}
+
+// putAll saves the records as-is locally and logs the changes
+func (s *SyncStore) putAll(records []Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := putAll(s.Store, records); err != nil {
+		return err
+	}
+	changes := make([]Change, len(records))
+	for i, record := range records {
+		changes[i] = Change{Op: putChange, Record: record, At: record.UpdatedAt}
+	}
+	return s.record(changes...)
+}
+
+// Pull applies the changes logged by every machine since the last pull
+func (s *SyncStore) Pull() (report SyncReport, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	logs, err := filepath.Glob(filepath.Join(s.config.Dir, "*.jsonl"))
+	if err != nil {
+		return
+	}
+	for _, log := range logs {
+		if err = s.pull(log, &report); err != nil {
+			return
+		}
+	}
+	s.pulled.Applied += report.Applied
+	s.pulled.Ignored += report.Ignored
+	err = s.saveState()
+	return
+}
+
+// Sync pulls every change log, seeds an empty local database from the shared
+// one, and merges any conflicted copies of the shared database. The report
+// includes the changes pulled since the last sync.
+func (s *SyncStore) Sync() (report SyncReport, err error) {
+	if _, err = s.Pull(); err != nil {
+		return
+	}
+	s.mutex.Lock()
+	report, s.pulled = s.pulled, SyncReport{}
+	s.mutex.Unlock()
+	if s.Count() == 0 && s.config.Shared != "" {
+		if report.Seeded, err = s.seed(); err != nil {
+			return
+		}
+	}
+	copies, err := conflictedCopies(s.config.Shared)
+	if err != nil {
+		return
+	}
+	for _, path := range copies {
+		if err = s.merge(path); err != nil {
+			return
+		}
+		report.Merged = append(report.Merged, filepath.Base(path))
+	}
+	return
+}
+
+// pull applies the new, complete lines of the change log
+func (s *SyncStore) pull(log string, report *SyncReport) error {
+	file, err := os.Open(log)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	name := filepath.Base(log)
+	offset := s.state.Offsets[name]
+	if info, err := file.Stat(); err != nil || info.Size() < offset {
+		// the log was replaced, so start over
+		offset = 0
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		var change Change
+		if json.Unmarshal(bytes.TrimSpace(line), &change) != nil || change.Record.ID == "" {
+			report.Ignored++
+			continue
+		}
+		applied, err := s.apply(change)
+		if err != nil {
+			return err
+		}
+		if applied {
+			report.Applied++
+		} else if change.Machine != s.config.Machine {
+			report.Ignored++
+		}
+	}
+	s.state.Offsets[name] = offset
+	return nil
+}
+
+// apply makes the change locally unless a newer version of the record is already
+// here. Usage is merged either way, keeping the larger count and the latest copy.
+func (s *SyncStore) apply(change Change) (bool, error) {
+	local, err := s.Store.Find(change.Record.ID)
+	exists := err == nil
+	if exists && !local.UpdatedAt.Before(change.At) {
+		if change.Op != putChange {
+			return false, nil
+		}
+		merged := withUsage(local, change.Record)
+		if merged.Count == local.Count && merged.CopiedAt.Equal(local.CopiedAt) {
+			return false, nil
+		}
+		return true, putAll(s.Store, []Record{merged})
+	}
+	deleted, wasDeleted := s.state.Deleted[change.Record.ID]
+	if wasDeleted && !deleted.Before(change.At) {
+		return false, nil
+	}
+	switch change.Op {
+	case putChange:
+		record := change.Record
+		if exists {
+			record = withUsage(record, local)
+		}
+		return true, putAll(s.Store, []Record{record})
+	case deleteChange:
+		s.state.Deleted[change.Record.ID] = change.At
+		if !exists {
+			return true, nil
+		}
+		_, err = s.Store.Delete(&local)
+		return true, err
+	}
+	return false, nil
+}
+
+// record appends the changes to this machine's change log
+func (s *SyncStore) record(changes ...Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	var lines bytes.Buffer
+	for _, change := range changes {
+		change.Machine = s.config.Machine
+		line, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		lines.Write(append(line, '\n'))
+	}
+	if err := os.MkdirAll(s.config.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	name := s.config.Machine + ".jsonl"
+	file, err := os.OpenFile(filepath.Join(s.config.Dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(lines.Bytes()); err != nil {
+		return err
+	}
+	// our own changes are already applied, unless the log has some we have yet to pull
+	if s.state.Offsets[name] == info.Size() {
+		s.state.Offsets[name] = info.Size() + int64(lines.Len())
+	}
+	return s.saveState()
+}
+
+func (s *SyncStore) saveState() error {
+	raw, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.statePath), os.ModePerm); err != nil {
+		return err
+	}
+	return writeFile(s.statePath, raw)
+}
+
+// seed copies the records in the shared database into the local one
+func (s *SyncStore) seed() (int, error) {
+	if _, err := os.Stat(s.config.Shared); os.IsNotExist(err) {
+		return 0, nil
+	}
+	records, err := readAll(s.config.Shared)
+	if err != nil {
+		return 0, err
+	}
+	report, err := importRecords(s.Store, records, Merge)
+	return report.Added, err
+}
+
+// merge combines a conflicted copy with the local records, logging whatever
+// changed, then sets the copy aside so it is only merged once
+func (s *SyncStore) merge(path string) error {
+	records, err := readAll(path)
+	if err != nil {
+		return fmt.Errorf("unable to merge %v: %v", path, err)
+	}
+	if _, err = importRecords(s, records, Merge); err != nil {
+		return err
+	}
+	return os.Rename(path, path+".merged")
+}
+
+// readAll returns every record in the bolt or JSON database at path
+func readAll(path string) (records []Record, err error) {
+	options := DefaultOptions
+	options.ReadOnly = true
+	if filepath.Ext(path) == ".json" {
+		options.Storage = JSONStorage
+	}
+	s, err := Open(path, options)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	err = s.Iterate(func(r Record) error {
+		records = append(records, r)
+		return nil
+	})
+	return
+}
+
+// conflictedCopies finds the copies Dropbox made of the database when it was
+// changed on more than one machine at once, like "gifs.bolt (laptop's conflicted copy 2018-05-09).db"
+func conflictedCopies(path string) (copies []string, err error) {
+	if path == "" {
+		return
+	}
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(filepath.Base(path), ext)
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !file.IsDir() && strings.HasPrefix(name, stem+" (") && strings.Contains(name, "conflicted copy") && strings.HasSuffix(name, ")"+ext) {
+			copies = append(copies, filepath.Join(filepath.Dir(path), name))
+		}
+	}
+	return
+}
@@ -0,0 +1,329 @@
+package gifkv
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var synced = time.Date(2018, 5, 9, 12, 0, 0, 0, time.UTC)
+
+// machines returns two sync stores sharing a change log directory, and a clock to move them along
+func machines(t *testing.T) (laptop *SyncStore, desktop *SyncStore, tick func(), cleanUp func()) {
+	dir, _ := ioutil.TempDir("", "gifkv-sync")
+	clock := synced
+	now = func() time.Time { return clock }
+	tick = func() { clock = clock.Add(time.Minute) }
+
+	shared := SyncConfig{Dir: filepath.Join(dir, "sync"), Shared: filepath.Join(dir, "gifs.bolt.db")}
+	laptopConfig, desktopConfig := shared, shared
+	laptopConfig.Machine = "laptop"
+	desktopConfig.Machine = "Josh's Desktop"
+	laptop, err := NewSyncStore(NewMemoryStore(), laptopConfig, filepath.Join(dir, "laptop", "sync.json"))
+	assert.Nil(t, err)
+	desktop, err = NewSyncStore(NewMemoryStore(), desktopConfig, filepath.Join(dir, "desktop", "sync.json"))
+	assert.Nil(t, err)
+	cleanUp = func() {
+		now = time.Now
+		os.RemoveAll(dir)
+	}
+	return
+}
+
+func TestNewSyncStore(t *testing.T) {
+	_, err := NewSyncStore(NewMemoryStore(), SyncConfig{Dir: "sync"}, "sync.json")
+	assert.NotNil(t, err)
+	assert.Equal(t, "syncing needs a directory and a machine name", err.Error())
+
+	laptop, desktop, _, cleanUp := machines(t)
+	defer cleanUp()
+	assert.Equal(t, "laptop", laptop.config.Machine)
+	assert.Equal(t, "Josh-s-Desktop", desktop.config.Machine)
+
+	record := generateRecord("checksum-a", "abcd")
+	laptop.Save(&record)
+	reopened, err := NewSyncStore(laptop.Store, laptop.config, laptop.statePath)
+	assert.Nil(t, err)
+	assert.Equal(t, laptop.state.Offsets, reopened.state.Offsets)
+
+	ioutil.WriteFile(laptop.statePath, []byte("not json"), 0600)
+	_, err = NewSyncStore(laptop.Store, laptop.config, laptop.statePath)
+	assert.NotNil(t, err)
+}
+
+func TestSyncPull(t *testing.T) {
+	laptop, desktop, tick, cleanUp := machines(t)
+	defer cleanUp()
+
+	record := generateRecord("checksum-a", "abcd")
+	laptop.Save(&record)
+	report, err := laptop.Pull()
+	assert.Nil(t, err)
+	assert.Equal(t, SyncReport{}, report)
+
+	report, err = desktop.Pull()
+	assert.Nil(t, err)
+	assert.Equal(t, SyncReport{Applied: 1}, report)
+	found, err := desktop.Find("checksum-a")
+	assert.Nil(t, err)
+	assert.Equal(t, "abcd", found.SharedLinkID)
+	assert.True(t, synced.Equal(found.CreatedAt))
+
+	tick()
+	copied(desktop, &found)
+	report, _ = laptop.Pull()
+	assert.Equal(t, SyncReport{Applied: 1}, report)
+	found, _ = laptop.Find("checksum-a")
+	assert.Equal(t, 1, found.Count)
+
+	report, _ = desktop.Pull()
+	assert.Equal(t, SyncReport{}, report)
+
+	report, err = laptop.Sync()
+	assert.Nil(t, err)
+	assert.Equal(t, SyncReport{Applied: 1}, report)
+	report, _ = laptop.Sync()
+	assert.Equal(t, SyncReport{}, report)
+}
+
+func TestSyncLastWriterWins(t *testing.T) {
+	laptop, desktop, tick, cleanUp := machines(t)
+	defer cleanUp()
+
+	record := generateRecord("checksum-a", "abcd")
+	laptop.Save(&record)
+	desktop.Pull()
+
+	laptopCopy, _ := laptop.Find("checksum-a")
+	desktopCopy, _ := desktop.Find("checksum-a")
+	tick()
+	laptopCopy.RemotePath = "s/OLDER"
+	laptop.Save(&laptopCopy)
+	tick()
+	desktopCopy.RemotePath = "s/NEWER"
+	desktop.Save(&desktopCopy)
+
+	report, _ := laptop.Pull()
+	assert.Equal(t, SyncReport{Applied: 1}, report)
+	report, _ = desktop.Pull()
+	assert.Equal(t, SyncReport{Ignored: 1}, report)
+	for _, s := range []*SyncStore{laptop, desktop} {
+		found, _ := s.Find("checksum-a")
+		assert.Equal(t, "s/NEWER", found.RemotePath)
+	}
+}
+
+func TestSyncCopiesKeepNewerLinks(t *testing.T) {
+	laptop, desktop, tick, cleanUp := machines(t)
+	defer cleanUp()
+
+	record := generateRecord("checksum-a", "abcd")
+	laptop.Save(&record)
+	desktop.Pull()
+
+	// the desktop copies the old link before it has pulled the laptop's relink
+	desktopCopy, _ := desktop.Find("checksum-a")
+	tick()
+	record.SharedLinkID = "efgh"
+	laptop.Save(&record)
+	tick()
+	copied(desktop, &desktopCopy)
+	copied(desktop, &desktopCopy)
+	copied(laptop, &record)
+
+	report, _ := laptop.Pull()
+	assert.Equal(t, SyncReport{Applied: 1, Ignored: 1}, report)
+	report, _ = desktop.Pull()
+	assert.Equal(t, SyncReport{Applied: 1, Ignored: 1}, report)
+	for _, s := range []*SyncStore{laptop, desktop} {
+		found, _ := s.Find("checksum-a")
+		assert.Equal(t, "efgh", found.SharedLinkID)
+		assert.Equal(t, 2, found.Count)
+		assert.True(t, synced.Add(2*time.Minute).Equal(found.CopiedAt))
+	}
+}
+
+func TestSyncDelete(t *testing.T) {
+	laptop, desktop, tick, cleanUp := machines(t)
+	defer cleanUp()
+
+	record := generateRecord("checksum-a", "abcd")
+	laptop.Save(&record)
+	desktop.Pull()
+
+	tick()
+	found, _ := desktop.Find("checksum-a")
+	desktop.Delete(&found)
+	report, _ := laptop.Pull()
+	assert.Equal(t, SyncReport{Applied: 1}, report)
+	assert.Equal(t, 0, laptop.Count())
+
+	// a change made before the delete stays deleted
+	stale := record
+	stale.Count = 5
+	laptop.putAll([]Record{stale})
+	laptop.Delete(&stale)
+	desktop.Pull()
+	assert.Equal(t, 0, desktop.Count())
+
+	// linking it again brings it back everywhere
+	tick()
+	relinked := generateRecord("checksum-a", "efgh")
+	laptop.Save(&relinked)
+	desktop.Pull()
+	found, err := desktop.Find("checksum-a")
+	assert.Nil(t, err)
+	assert.Equal(t, "efgh", found.SharedLinkID)
+}
+
+func TestSyncConcurrentChanges(t *testing.T) {
+	laptop, desktop, _, cleanUp := machines(t)
+	defer cleanUp()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				record := generateRecord(fmt.Sprintf("checksum-%d-%d", i, j), "abcd")
+				laptop.Save(&record)
+				if j%2 == 1 {
+					laptop.Delete(&record)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 40, laptop.Count())
+
+	// every change made it into the log whole, and the log's offset is where it ends
+	raw, err := ioutil.ReadFile(filepath.Join(laptop.config.Dir, "laptop.jsonl"))
+	assert.Nil(t, err)
+	assert.Equal(t, 120, bytes.Count(raw, []byte("\n")))
+	assert.Equal(t, int64(len(raw)), laptop.state.Offsets["laptop.jsonl"])
+	report, err := laptop.Pull()
+	assert.Nil(t, err)
+	assert.Equal(t, SyncReport{}, report)
+	_, err = desktop.Pull()
+	assert.Nil(t, err)
+}
+
+func TestSyncSeedAndConflictedCopies(t *testing.T) {
+	laptop, desktop, tick, cleanUp := machines(t)
+	defer cleanUp()
+
+	shared, _ := OpenBolt(laptop.config.Shared, DefaultOptions)
+	seeded := generateRecord("checksum-a", "abcd")
+	shared.Save(&seeded)
+	shared.Close()
+
+	tick()
+	conflicted := filepath.Join(filepath.Dir(laptop.config.Shared), "gifs.bolt (Josh's conflicted copy 2018-05-09).db")
+	conflict, _ := OpenBolt(conflicted, DefaultOptions)
+	newer := generateRecord("checksum-a", "efgh")
+	other := generateRecord("checksum-b", "ijkl")
+	conflict.Save(&newer)
+	conflict.Save(&other)
+	conflict.Close()
+	ioutil.WriteFile(filepath.Join(filepath.Dir(laptop.config.Shared), "gifs (notes).txt"), []byte{}, 0600)
+
+	report, err := laptop.Sync()
+	assert.Nil(t, err)
+	assert.Equal(t, SyncReport{Seeded: 1, Merged: []string{"gifs.bolt (Josh's conflicted copy 2018-05-09).db"}}, report)
+	assert.Equal(t, "1 record seeded, 0 changes applied, 0 ignored\nMerged gifs.bolt (Josh's conflicted copy 2018-05-09).db", report.String())
+	found, _ := laptop.Find("checksum-a")
+	assert.Equal(t, "efgh", found.SharedLinkID)
+	assert.Equal(t, 2, laptop.Count())
+	_, err = os.Stat(conflicted + ".merged")
+	assert.Nil(t, err)
+
+	report, err = desktop.Sync()
+	assert.Nil(t, err)
+	assert.Equal(t, SyncReport{Applied: 2}, report)
+	found, _ = desktop.Find("checksum-a")
+	assert.Equal(t, "efgh", found.SharedLinkID)
+}
+
+func TestSyncIgnoresBrokenLines(t *testing.T) {
+	laptop, desktop, _, cleanUp := machines(t)
+	defer cleanUp()
+
+	record := generateRecord("checksum-a", "abcd")
+	laptop.Save(&record)
+	log, _ := os.OpenFile(filepath.Join(laptop.config.Dir, "laptop.jsonl"), os.O_APPEND|os.O_WRONLY, 0600)
+	log.WriteString("{broken\n{\"op\":\"put\",\"record\":{\"checksum\":\"partial")
+	log.Close()
+
+	report, err := desktop.Pull()
+	assert.Nil(t, err)
+	assert.Equal(t, SyncReport{Applied: 1, Ignored: 1}, report)
+	assert.Equal(t, 1, desktop.Count())
+}
+
+func TestConflictedCopies(t *testing.T) {
+	copies, err := conflictedCopies("")
+	assert.Nil(t, err)
+	assert.Nil(t, copies)
+
+	copies, err = conflictedCopies("/missing/gifs.bolt.db")
+	assert.Nil(t, err)
+	assert.Nil(t, copies)
+}
+
+func TestSyncSwitchingProfiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gifkv-profiles")
+	defer func() {
+		Disconnect()
+		StopSync()
+		initDbPath()
+		os.RemoveAll(dir)
+	}()
+
+	// another machine logs more changes for the work profile than for the personal one
+	profiles := map[string]SyncConfig{}
+	for _, suffix := range []string{"", "-work"} {
+		profiles[suffix] = SyncConfig{
+			Dir:     filepath.Join(dir, "Dropbox", ".gifs", "sync"+suffix),
+			Machine: "laptop",
+			State:   filepath.Join(dir, ".dgl", fmt.Sprintf("sync%v.json", suffix)),
+		}
+		desktopConfig := profiles[suffix]
+		desktopConfig.Machine = "desktop"
+		desktop, err := NewSyncStore(NewMemoryStore(), desktopConfig, filepath.Join(dir, "desktop", fmt.Sprintf("sync%v.json", suffix)))
+		assert.Nil(t, err)
+		count := 3
+		if suffix == "" {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			record := generateRecord(fmt.Sprintf("checksum%v-%d", suffix, i), "abcd")
+			desktop.Save(&record)
+		}
+	}
+
+	use := func(suffix string) {
+		SetDatabasePath(filepath.Join(dir, ".dgl", fmt.Sprintf("gifs%v.bolt.db", suffix)))
+		SetSync(profiles[suffix])
+		ok, err := Connect()
+		assert.True(t, ok)
+		assert.Nil(t, err)
+	}
+	use("")
+	assert.Equal(t, 1, Count())
+	// the work profile reads its change logs from the start, not from where the
+	// personal profile got to
+	use("-work")
+	assert.Equal(t, 3, Count())
+	_, err := Find("checksum-work-0")
+	assert.Nil(t, err)
+	use("")
+	assert.Equal(t, 1, Count())
+}
@@ -0,0 +1,326 @@
+package gifkv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Export formats
+const (
+	JSONLines = "jsonl"
+	CSV       = "csv"
+)
+
+// ImportPolicy decides what happens when an imported record already exists
+type ImportPolicy string
+
+// Import policies
+const (
+	// Merge keeps the existing record, filling in its blanks and combining its usage
+	Merge ImportPolicy = "merge"
+	// Overwrite replaces the existing record
+	Overwrite ImportPolicy = "overwrite"
+	// Skip leaves the existing record untouched
+	Skip ImportPolicy = "skip"
+)
+
+// ImportReport counts what happened to each imported record
+type ImportReport struct {
+	Added   int
+	Updated int
+	Skipped int
+}
+
+// String returns a summary of the report
+func (i ImportReport) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d skipped", i.Added, i.Updated, i.Skipped)
+}
+
+var csvHeader = []string{
+	"checksum", "base_name", "directory", "file_size", "shared_link_id", "remote_path",
+	"width", "height", "count", "created_at", "updated_at", "copied_at",
+}
+
+// export writes every record in the store in the format, returning the number written
+func export(s Store, w io.Writer, format string) (count int, err error) {
+	var write func(Record) error
+	var flush func() error
+	switch format {
+	case JSONLines:
+		encoder := json.NewEncoder(w)
+		write = func(r Record) error { return encoder.Encode(r) }
+		flush = func() error { return nil }
+	case CSV:
+		writer := csv.NewWriter(w)
+		if err = writer.Write(csvHeader); err != nil {
+			return
+		}
+		write = func(r Record) error { return writer.Write(r.csv()) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		err = fmt.Errorf("unsupported export format [%v]", format)
+		return
+	}
+	err = s.Iterate(func(r Record) error {
+		count++
+		return write(r)
+	})
+	if err != nil {
+		return
+	}
+	err = flush()
+	return
+}
+
+// importFrom reads records in the format into the store, resolving conflicts
+// with existing records using the policy. Nothing is written if any record is invalid.
+func importFrom(s Store, r io.Reader, format string, policy ImportPolicy) (report ImportReport, err error) {
+	if policy != Merge && policy != Overwrite && policy != Skip {
+		err = fmt.Errorf("unsupported import policy [%v]", policy)
+		return
+	}
+	var records []Record
+	switch format {
+	case JSONLines:
+		records, err = readJSONLines(r)
+	case CSV:
+		records, err = readCSV(r)
+	default:
+		err = fmt.Errorf("unsupported import format [%v]", format)
+	}
+	if err != nil {
+		return
+	}
+	return importRecords(s, records, policy)
+}
+
+// importRecords saves the records to the store, resolving conflicts with
+// existing records using the policy
+func importRecords(s Store, records []Record, policy ImportPolicy) (report ImportReport, err error) {
+	if policy != Merge && policy != Overwrite && policy != Skip {
+		err = fmt.Errorf("unsupported import policy [%v]", policy)
+		return
+	}
+	existing := make(map[string]Record)
+	err = s.Iterate(func(r Record) error {
+		existing[r.ID] = r
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	var writes []Record
+	for _, record := range records {
+		if current, ok := existing[record.ID]; !ok {
+			report.Added++
+		} else if policy == Skip {
+			report.Skipped++
+			continue
+		} else {
+			if policy == Merge {
+				record = merge(current, record)
+				if same(current, record) {
+					report.Skipped++
+					continue
+				}
+			}
+			report.Updated++
+		}
+		existing[record.ID] = record
+		writes = append(writes, record)
+	}
+	if err = putAll(s, writes); err != nil {
+		report = ImportReport{}
+	}
+	return
+}
+
+// same returns whether the records hold the same details, regardless of their versions
+func same(a Record, b Record) bool {
+	a.Version, b.Version = 0, 0
+	return bytes.Equal(a.json(), b.json())
+}
+
+// batchWriter is implemented by stores that can save records as-is, all at once
+type batchWriter interface {
+	putAll(records []Record) error
+}
+
+// putAll saves the records as-is when the store supports it, or one at a time otherwise
+func putAll(s Store, records []Record) error {
+	if w, ok := s.(batchWriter); ok {
+		return w.putAll(records)
+	}
+	for i := range records {
+		if _, err := s.Save(&records[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withUsage returns the record with the larger count and the latest copy of
+// the two versions
+func withUsage(r Record, other Record) Record {
+	if other.Count > r.Count {
+		r.Count = other.Count
+	}
+	if other.CopiedAt.After(r.CopiedAt) {
+		r.CopiedAt = other.CopiedAt
+	}
+	return r
+}
+
+// merge combines two versions of a record. The most recently updated version
+// wins for the link details, and blanks are filled in from the other. Usage
+// keeps the larger count and the latest copy, rather than adding the counts,
+// so merging the same export twice doesn't count its copies twice.
+func merge(existing Record, incoming Record) (merged Record) {
+	merged, other := existing, incoming
+	if incoming.UpdatedAt.After(existing.UpdatedAt) {
+		merged, other = incoming, existing
+	}
+	if merged.BaseName == "" {
+		merged.BaseName = other.BaseName
+	}
+	if merged.Directory == "" {
+		merged.Directory = other.Directory
+	}
+	if merged.FileSize == 0 {
+		merged.FileSize = other.FileSize
+	}
+	if merged.SharedLinkID == "" {
+		merged.SharedLinkID = other.SharedLinkID
+	}
+	if merged.RemotePath == "" {
+		merged.RemotePath = other.RemotePath
+	}
+	if merged.Width == 0 || merged.Height == 0 {
+		merged.Width, merged.Height = other.Width, other.Height
+	}
+	merged = withUsage(merged, other)
+	if merged.CreatedAt.IsZero() || (!other.CreatedAt.IsZero() && other.CreatedAt.Before(merged.CreatedAt)) {
+		merged.CreatedAt = other.CreatedAt
+	}
+	return
+}
+
+func readJSONLines(r io.Reader) (records []Record, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if record.ID == "" {
+			return nil, fmt.Errorf("line %d: missing checksum", line)
+		}
+		records = append(records, record)
+	}
+	err = scanner.Err()
+	return
+}
+
+func readCSV(r io.Reader) (records []Record, err error) {
+	reader := csv.NewReader(r)
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return
+	}
+	if len(rows) == 0 {
+		return
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	if _, ok := columns["checksum"]; !ok {
+		return nil, errors.New("line 1: missing checksum column")
+	}
+	for i, row := range rows[1:] {
+		var record Record
+		if record, err = fromCSV(row, columns); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+2, err)
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+func (r Record) csv() []string {
+	return []string{
+		r.ID, r.BaseName, r.Directory, strconv.Itoa(r.FileSize), r.SharedLinkID, r.RemotePath,
+		strconv.Itoa(r.Width), strconv.Itoa(r.Height), strconv.Itoa(r.Count),
+		csvTime(r.CreatedAt), csvTime(r.UpdatedAt), csvTime(r.CopiedAt),
+	}
+}
+
+func fromCSV(row []string, columns map[string]int) (r Record, err error) {
+	value := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	number := func(name string) int {
+		if err != nil || value(name) == "" {
+			return 0
+		}
+		var n int
+		if n, err = strconv.Atoi(value(name)); err != nil {
+			err = fmt.Errorf("invalid %v %q", name, value(name))
+		}
+		return n
+	}
+	timestamp := func(name string) time.Time {
+		if err != nil || value(name) == "" {
+			return time.Time{}
+		}
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, value(name)); err != nil {
+			err = fmt.Errorf("invalid %v %q", name, value(name))
+		}
+		return t
+	}
+	r = Record{
+		ID:           value("checksum"),
+		BaseName:     value("base_name"),
+		Directory:    value("directory"),
+		FileSize:     number("file_size"),
+		SharedLinkID: value("shared_link_id"),
+		RemotePath:   value("remote_path"),
+		Width:        number("width"),
+		Height:       number("height"),
+		Count:        number("count"),
+		CreatedAt:    timestamp("created_at"),
+		UpdatedAt:    timestamp("updated_at"),
+		CopiedAt:     timestamp("copied_at"),
+	}
+	if err == nil && r.ID == "" {
+		err = errors.New("missing checksum")
+	}
+	return
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,152 @@
+package gifkv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var exported = time.Date(2018, 5, 9, 12, 0, 0, 0, time.UTC)
+
+func exportSetUp() {
+	setUp()
+	now = func() time.Time { return exported }
+	record := generateRecord("checksum-a", "abcd")
+	record.Copied()
+	now = time.Now
+}
+
+func TestExportJSONLines(t *testing.T) {
+	exportSetUp()
+
+	var buf bytes.Buffer
+	count, err := Export(&buf, JSONLines)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, `{"checksum":"checksum-a","base_name":"swiftie life 'the best' - 02.gif","directory":"/taylor swift","file_size":3456,"shared_link_id":"abcd","remote_path":"s/DROPBOX_HASH","count":1,"created_at":"2018-05-09T12:00:00Z","updated_at":"2018-05-09T12:00:00Z","copied_at":"2018-05-09T12:00:00Z","version":2}`+"\n", buf.String())
+
+	_, err = Export(&buf, "xml")
+	assert.NotNil(t, err)
+	assert.Equal(t, "unsupported export format [xml]", err.Error())
+
+	tearDown()
+}
+
+func TestExportCSV(t *testing.T) {
+	exportSetUp()
+
+	var buf bytes.Buffer
+	count, err := Export(&buf, CSV)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "checksum,base_name,directory,file_size,shared_link_id,remote_path,width,height,count,created_at,updated_at,copied_at\n"+
+		"checksum-a,swiftie life 'the best' - 02.gif,/taylor swift,3456,abcd,s/DROPBOX_HASH,0,0,1,2018-05-09T12:00:00Z,2018-05-09T12:00:00Z,2018-05-09T12:00:00Z\n", buf.String())
+
+	tearDown()
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{JSONLines, CSV} {
+		exportSetUp()
+		original, _ := Find("checksum-a")
+
+		var buf bytes.Buffer
+		Export(&buf, format)
+		original.Delete()
+
+		report, err := Import(&buf, format, Merge)
+		assert.Nil(t, err)
+		assert.Equal(t, ImportReport{Added: 1}, report)
+
+		imported, err := Find("checksum-a")
+		assert.Nil(t, err)
+		assert.Equal(t, original.BaseName, imported.BaseName)
+		assert.Equal(t, original.Count, imported.Count)
+		assert.True(t, original.CreatedAt.Equal(imported.CreatedAt))
+		found, _ := FindBySharedLinkID("abcd")
+		assert.Equal(t, "checksum-a", found.ID)
+
+		tearDown()
+	}
+}
+
+func TestImportPolicies(t *testing.T) {
+	newer := `{"checksum":"checksum-a","base_name":"renamed.gif","shared_link_id":"efgh","count":4,"updated_at":"2019-01-01T00:00:00Z","copied_at":"2017-01-01T00:00:00Z"}
+{"checksum":"checksum-b","base_name":"new.gif"}`
+
+	exportSetUp()
+	report, err := Import(strings.NewReader(newer), JSONLines, Skip)
+	assert.Nil(t, err)
+	assert.Equal(t, "1 added, 0 updated, 1 skipped", report.String())
+	record, _ := Find("checksum-a")
+	assert.Equal(t, "abcd", record.SharedLinkID)
+	tearDown()
+
+	exportSetUp()
+	report, err = Import(strings.NewReader(newer), JSONLines, Overwrite)
+	assert.Nil(t, err)
+	assert.Equal(t, "1 added, 1 updated, 0 skipped", report.String())
+	record, _ = Find("checksum-a")
+	assert.Equal(t, "renamed.gif", record.BaseName)
+	assert.Equal(t, "", record.Directory)
+	tearDown()
+
+	exportSetUp()
+	report, err = Import(strings.NewReader(newer), JSONLines, Merge)
+	assert.Nil(t, err)
+	assert.Equal(t, "1 added, 1 updated, 0 skipped", report.String())
+	record, _ = Find("checksum-a")
+	assert.Equal(t, "renamed.gif", record.BaseName)
+	assert.Equal(t, "efgh", record.SharedLinkID)
+	assert.Equal(t, "/taylor swift", record.Directory)
+	assert.Equal(t, 3456, record.FileSize)
+	assert.Equal(t, 4, record.Count)
+	assert.True(t, exported.Equal(record.CreatedAt))
+	assert.True(t, exported.Equal(record.CopiedAt))
+	_, err = FindBySharedLinkID("abcd")
+	assert.NotNil(t, err)
+	tearDown()
+}
+
+func TestImportUnchanged(t *testing.T) {
+	exportSetUp()
+
+	var buf bytes.Buffer
+	Export(&buf, JSONLines)
+	report, err := Import(&buf, JSONLines, Merge)
+	assert.Nil(t, err)
+	assert.Equal(t, ImportReport{Skipped: 1}, report)
+
+	tearDown()
+}
+
+func TestImportInvalid(t *testing.T) {
+	exportSetUp()
+
+	_, err := Import(strings.NewReader(`{"checksum":"x"}`+"\n"+`{"base_name":"y.gif"}`), JSONLines, Merge)
+	assert.NotNil(t, err)
+	assert.Equal(t, "line 2: missing checksum", err.Error())
+	_, err = Find("x")
+	assert.NotNil(t, err)
+
+	_, err = Import(strings.NewReader("checksum,file_size\nx,big\n"), CSV, Merge)
+	assert.NotNil(t, err)
+	assert.Equal(t, "line 2: invalid file_size \"big\"", err.Error())
+
+	_, err = Import(strings.NewReader("base_name\ny.gif\n"), CSV, Merge)
+	assert.NotNil(t, err)
+	assert.Equal(t, "line 1: missing checksum column", err.Error())
+
+	_, err = Import(strings.NewReader(""), JSONLines, "replace")
+	assert.NotNil(t, err)
+	assert.Equal(t, "unsupported import policy [replace]", err.Error())
+
+	_, err = Import(strings.NewReader(""), "xml", Merge)
+	assert.NotNil(t, err)
+	assert.Equal(t, "unsupported import format [xml]", err.Error())
+
+	tearDown()
+}
@@ -0,0 +1,106 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+// Entry is a processed record, along with the input that produced it
+type Entry struct {
+	Input  string
+	Record gifkv.Record
+}
+
+// History is a bounded stack of the records processed during a session.
+// Entries are numbered from 1, the most recent.
+type History struct {
+	entries []Entry
+	limit   int
+}
+
+// New returns an empty History holding at most limit entries
+func New(limit int) *History {
+	return &History{limit: limit}
+}
+
+// Push adds the entries as the most recent, moving any record already in the
+// history to the top and dropping the oldest entries beyond the limit
+func (h *History) Push(entries ...Entry) {
+	for _, e := range entries {
+		for i := range h.entries {
+			if h.entries[i].Record.ID == e.Record.ID {
+				h.entries = append(h.entries[:i], h.entries[i+1:]...)
+				break
+			}
+		}
+		h.entries = append(h.entries, e)
+	}
+	if h.limit > 0 && len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+	}
+}
+
+// Len returns the number of entries
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// Entries returns every entry, most recent first
+func (h *History) Entries() (entries []Entry) {
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entries = append(entries, h.entries[i])
+	}
+	return
+}
+
+// Get returns the numbered entry
+func (h *History) Get(number int) (e Entry, err error) {
+	i, err := h.index(number)
+	if err != nil {
+		return
+	}
+	return h.entries[i], nil
+}
+
+// Remove drops the numbered entry, returning it
+func (h *History) Remove(number int) (e Entry, err error) {
+	i, err := h.index(number)
+	if err != nil {
+		return
+	}
+	e = h.entries[i]
+	h.entries = append(h.entries[:i], h.entries[i+1:]...)
+	return
+}
+
+// RemoveRecord drops the entry for the record, if there is one
+func (h *History) RemoveRecord(checksum string) {
+	for i := range h.entries {
+		if h.entries[i].Record.ID == checksum {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Back drops the most recent entry, returning the one before it
+func (h *History) Back() (e Entry, err error) {
+	if len(h.entries) < 2 {
+		err = errors.New("nothing to go back to")
+		return
+	}
+	h.entries = h.entries[:len(h.entries)-1]
+	return h.entries[len(h.entries)-1], nil
+}
+
+func (h *History) index(number int) (int, error) {
+	if len(h.entries) == 0 {
+		return 0, errors.New("the history is empty")
+	}
+	if number < 1 || number > len(h.entries) {
+		return 0, fmt.Errorf("pick a number from 1 to %d", len(h.entries))
+	}
+	return len(h.entries) - number, nil
+}
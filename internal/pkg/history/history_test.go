@@ -0,0 +1,89 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+func entry(checksum string) Entry {
+	return Entry{Input: "/gifs/" + checksum + ".gif", Record: gifkv.Record{ID: checksum}}
+}
+
+func checksums(entries []Entry) (ids []string) {
+	for _, e := range entries {
+		ids = append(ids, e.Record.ID)
+	}
+	return
+}
+
+func TestPush(t *testing.T) {
+	h := New(3)
+	assert.Equal(t, 0, h.Len())
+
+	h.Push(entry("a"), entry("b"))
+	assert.Equal(t, []string{"b", "a"}, checksums(h.Entries()))
+
+	// repeats move to the top
+	h.Push(entry("a"))
+	assert.Equal(t, []string{"a", "b"}, checksums(h.Entries()))
+
+	// the oldest are dropped beyond the limit
+	h.Push(entry("c"), entry("d"))
+	assert.Equal(t, 3, h.Len())
+	assert.Equal(t, []string{"d", "c", "a"}, checksums(h.Entries()))
+}
+
+func TestGet(t *testing.T) {
+	h := New(10)
+	_, err := h.Get(1)
+	assert.NotNil(t, err)
+	assert.Equal(t, "the history is empty", err.Error())
+
+	h.Push(entry("a"), entry("b"))
+	e, err := h.Get(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", e.Record.ID)
+	assert.Equal(t, "/gifs/b.gif", e.Input)
+
+	e, err = h.Get(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", e.Record.ID)
+
+	_, err = h.Get(3)
+	assert.NotNil(t, err)
+	assert.Equal(t, "pick a number from 1 to 2", err.Error())
+}
+
+func TestRemove(t *testing.T) {
+	h := New(10)
+	h.Push(entry("a"), entry("b"), entry("c"))
+
+	e, err := h.Remove(2)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", e.Record.ID)
+	assert.Equal(t, []string{"c", "a"}, checksums(h.Entries()))
+
+	_, err = h.Remove(0)
+	assert.NotNil(t, err)
+
+	h.RemoveRecord("c")
+	assert.Equal(t, []string{"a"}, checksums(h.Entries()))
+	h.RemoveRecord("missing")
+	assert.Equal(t, []string{"a"}, checksums(h.Entries()))
+}
+
+func TestBack(t *testing.T) {
+	h := New(10)
+	h.Push(entry("a"), entry("b"))
+
+	e, err := h.Back()
+	assert.Nil(t, err)
+	assert.Equal(t, "a", e.Record.ID)
+	assert.Equal(t, []string{"a"}, checksums(h.Entries()))
+
+	_, err = h.Back()
+	assert.NotNil(t, err)
+	assert.Equal(t, "nothing to go back to", err.Error())
+}
@@ -0,0 +1,160 @@
+// Package httpclient sends HTTP requests with timeouts, retrying the ones that
+// fail for reasons that are likely to pass
+package httpclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Doer sends a request. Both *http.Client and *Client are Doers.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Settings control how long requests can take, and how they are retried
+type Settings struct {
+	// Timeout is how long each attempt can take, including reading the body
+	Timeout time.Duration
+	// Retries is how many more attempts are made after a failure
+	Retries int
+	// Backoff is the wait before the first retry, which doubles with each retry
+	Backoff time.Duration
+	// MaxBackoff caps the wait between attempts. A Retry-After longer than it
+	// isn't waited for, and its response is returned instead.
+	MaxBackoff time.Duration
+}
+
+// DefaultSettings are used for anything that isn't configured
+var DefaultSettings = Settings{
+	Timeout:    30 * time.Second,
+	Retries:    3,
+	Backoff:    500 * time.Millisecond,
+	MaxBackoff: 30 * time.Second,
+}
+
+// Client retries requests that fail with a network error, a server error, or
+// too many requests, waiting as long as the server asks when it says
+type Client struct {
+	Settings
+	http  *http.Client
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a client using the settings
+func New(settings Settings) *Client {
+	return &Client{
+		Settings: settings,
+		http:     &http.Client{Timeout: settings.Timeout},
+		sleep:    sleep,
+	}
+}
+
+// Default returns a client using the default settings
+func Default() *Client {
+	return New(DefaultSettings)
+}
+
+// Do sends the request, retrying it when it fails and there are retries left.
+// The last response is returned as-is once the retries run out, so callers
+// still see the status. Requests with a body are only retried when it can be
+// read again, which it can for those made by http.NewRequest.
+func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil && req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return
+			}
+		}
+		resp, err = c.http.Do(req)
+		wait, retry := c.retry(resp, err, attempt)
+		if !retry || ctx.Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			return
+		}
+		if resp != nil {
+			discard(resp)
+		}
+		if err = c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retry returns whether the attempt should be retried, and how long to wait first
+func (c *Client) retry(resp *http.Response, err error, attempt int) (wait time.Duration, retry bool) {
+	if attempt >= c.Retries {
+		return
+	}
+	wait = c.backoff(attempt)
+	switch {
+	case err != nil:
+		retry = true
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if after, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			// retrying any sooner than asked would only be refused again
+			if c.MaxBackoff > 0 && after > c.MaxBackoff {
+				return 0, false
+			}
+			wait = after
+		}
+		retry = true
+	case resp.StatusCode >= 500:
+		retry = true
+	}
+	return
+}
+
+// backoff doubles the initial wait for each attempt already made, up to the maximum
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.Backoff
+	for i := 0; i < attempt; i++ {
+		if c.MaxBackoff > 0 && wait >= c.MaxBackoff {
+			return c.MaxBackoff
+		}
+		wait *= 2
+	}
+	if c.MaxBackoff > 0 && wait > c.MaxBackoff {
+		return c.MaxBackoff
+	}
+	return wait
+}
+
+// retryAfter reads a Retry-After header, given in seconds or as a date
+func retryAfter(value string, now time.Time) (wait time.Duration, ok bool) {
+	if value == "" {
+		return
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait = at.Sub(now); wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return
+}
+
+// discard reads what's left of an unused response, so its connection can be reused
+func discard(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+}
+
+// sleep waits for the duration, or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,224 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stub answers with each status in turn, repeating the last, and records the bodies sent
+type stub struct {
+	mutex    sync.Mutex
+	statuses []int
+	headers  map[int]http.Header
+	bodies   []string
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+	status := s.statuses[0]
+	if len(s.statuses) > 1 {
+		s.statuses = s.statuses[1:]
+	}
+	for name, values := range s.headers[status] {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(status)
+}
+
+func (s *stub) attempts() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.bodies)
+}
+
+// testClient records the waits instead of sleeping through them
+func testClient(settings Settings) (c *Client, waits *[]time.Duration) {
+	waits = &[]time.Duration{}
+	c = New(settings)
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+	return
+}
+
+var testSettings = Settings{Timeout: time.Second, Retries: 3, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+func TestDoRetriesServerErrors(t *testing.T) {
+	assert := assert.New(t)
+	s := &stub{statuses: []int{500, 503, 200}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c, waits := testClient(testSettings)
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL, bytes.NewBufferString("payload"))
+	resp, err := c.Do(req)
+	assert.Nil(err)
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal([]string{"payload", "payload", "payload"}, s.bodies)
+	assert.Equal([]time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, *waits)
+}
+
+func TestDoGivesUp(t *testing.T) {
+	assert := assert.New(t)
+	s := &stub{statuses: []int{502}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c, waits := testClient(testSettings)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := c.Do(req)
+	assert.Nil(err)
+	assert.Equal(502, resp.StatusCode)
+	assert.Equal(4, s.attempts())
+	assert.Equal([]time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, *waits)
+}
+
+func TestDoLeavesClientErrors(t *testing.T) {
+	assert := assert.New(t)
+	for _, status := range []int{400, 404, 409} {
+		s := &stub{statuses: []int{status, 200}}
+		ts := httptest.NewServer(s)
+		c, waits := testClient(testSettings)
+
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		resp, err := c.Do(req)
+		assert.Nil(err)
+		assert.Equal(status, resp.StatusCode)
+		assert.Equal(1, s.attempts())
+		assert.Empty(*waits)
+		ts.Close()
+	}
+}
+
+func TestDoHonorsRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	s := &stub{
+		statuses: []int{429, 429, 200},
+		headers:  map[int]http.Header{429: {"Retry-After": []string{"0"}}},
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c, waits := testClient(testSettings)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := c.Do(req)
+	assert.Nil(err)
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal([]time.Duration{0, 0}, *waits)
+
+	// the whole wait is taken, even past the backoff
+	s = &stub{
+		statuses: []int{429, 200},
+		headers:  map[int]http.Header{429: {"Retry-After": []string{"1"}}},
+	}
+	ts2 := httptest.NewServer(s)
+	defer ts2.Close()
+	c, waits = testClient(Settings{Timeout: time.Second, Retries: 3, Backoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second})
+	req, _ = http.NewRequest(http.MethodGet, ts2.URL, nil)
+	resp, err = c.Do(req)
+	assert.Nil(err)
+	assert.Equal(200, resp.StatusCode)
+	assert.Equal([]time.Duration{time.Second}, *waits)
+
+	// waits longer than the maximum aren't retried early, the response is returned
+	s = &stub{
+		statuses: []int{429, 200},
+		headers:  map[int]http.Header{429: {"Retry-After": []string{"300"}}},
+	}
+	ts3 := httptest.NewServer(s)
+	defer ts3.Close()
+	c, waits = testClient(testSettings)
+	req, _ = http.NewRequest(http.MethodGet, ts3.URL, nil)
+	resp, err = c.Do(req)
+	assert.Nil(err)
+	assert.Equal(429, resp.StatusCode)
+	assert.Equal(1, s.attempts())
+	assert.Empty(*waits)
+}
+
+func TestDoRetriesNetworkErrors(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(&stub{statuses: []int{200}})
+	url := ts.URL
+	ts.Close()
+	c, waits := testClient(testSettings)
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	_, err := c.Do(req)
+	assert.NotNil(err)
+	assert.Len(*waits, 3)
+}
+
+func TestDoTimeout(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+	c, _ := testClient(Settings{Timeout: 20 * time.Millisecond})
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	_, err := c.Do(req)
+	assert.NotNil(err)
+}
+
+func TestDoCanceled(t *testing.T) {
+	assert := assert.New(t)
+	s := &stub{statuses: []int{503}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := New(Settings{Timeout: time.Second, Retries: 3, Backoff: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	started := time.Now()
+	_, err := c.Do(req.WithContext(ctx))
+	assert.Equal(context.Canceled, err)
+	assert.Equal(1, s.attempts())
+	assert.True(time.Since(started) < time.Minute)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2020, 10, 30, 12, 0, 0, 0, time.UTC)
+
+	wait, ok := retryAfter("5", now)
+	assert.True(ok)
+	assert.Equal(5*time.Second, wait)
+
+	wait, ok = retryAfter("Fri, 30 Oct 2020 12:00:30 GMT", now)
+	assert.True(ok)
+	assert.Equal(30*time.Second, wait)
+
+	wait, ok = retryAfter("Fri, 30 Oct 2020 11:00:00 GMT", now)
+	assert.True(ok)
+	assert.Equal(time.Duration(0), wait)
+
+	_, ok = retryAfter("", now)
+	assert.False(ok)
+	_, ok = retryAfter("soon", now)
+	assert.False(ok)
+	_, ok = retryAfter("-1", now)
+	assert.False(ok)
+}
+
+func TestBackoff(t *testing.T) {
+	c := New(Settings{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+	assert.Equal(t, time.Second, c.backoff(0))
+	assert.Equal(t, 4*time.Second, c.backoff(2))
+	assert.Equal(t, 5*time.Second, c.backoff(3))
+	assert.Equal(t, 5*time.Second, c.backoff(100))
+}
@@ -0,0 +1,201 @@
+// Package legacy reads gif links from the SQLite database used before 1.1.0,
+// as documented in db/schema.sql
+package legacy
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/sqlite"
+)
+
+// Problem describes a row that was skipped or conflicted with another
+type Problem struct {
+	Table  string
+	ID     string
+	Reason string
+}
+
+// String returns a formatted problem
+func (p Problem) String() string {
+	return fmt.Sprintf("%v %v: %v", p.Table, p.ID, p.Reason)
+}
+
+// Report holds the records read from a legacy database, and the rows that could not be used as-is
+type Report struct {
+	Records   []gifkv.Record
+	Skipped   []Problem
+	Conflicts []Problem
+}
+
+// timeLayouts are the ways datetimes were written to the legacy database
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+type link struct {
+	id         string
+	remotePath string
+	count      int
+	createdAt  time.Time
+	updatedAt  time.Time
+}
+
+// Read maps the gifs and shared_links tables of the legacy database at path onto records.
+// Each gif uses the shared link its shared_link_id names, falling back to the links whose
+// gif_id points back at it. Gifs without a checksum or a shared link are skipped. When a gif
+// has several shared links and names none of them, or several gifs share a checksum, the
+// most used (then most recently updated) one wins.
+func Read(path string) (report Report, err error) {
+	db, err := sqlite.Open(path)
+	if err != nil {
+		return
+	}
+	gifs, err := db.Rows("gifs")
+	if err != nil {
+		return
+	}
+	sharedLinks, err := db.Rows("shared_links")
+	if err != nil {
+		return
+	}
+
+	gifIDs := make(map[int64]bool)
+	named := make(map[string]bool)
+	for _, gif := range gifs {
+		gifIDs[gif.Int("id")] = true
+		named[gif.String("shared_link_id")] = true
+	}
+	byID := make(map[string]link)
+	links := make(map[int64][]link)
+	for _, row := range sharedLinks {
+		l := link{
+			id:         row.String("id"),
+			remotePath: row.String("remote_path"),
+			count:      int(row.Int("count")),
+			createdAt:  parseTime(row.String("created_at")),
+			updatedAt:  parseTime(row.String("updated_at")),
+		}
+		byID[l.id] = l
+		gifID := row.Int("gif_id")
+		if gifIDs[gifID] {
+			links[gifID] = append(links[gifID], l)
+		} else if !named[l.id] {
+			report.Skipped = append(report.Skipped, Problem{"shared_links", l.id, fmt.Sprintf("no gif with id %d", gifID)})
+		}
+	}
+
+	records := make(map[string]gifkv.Record)
+	sources := make(map[string]string)
+	for _, gif := range gifs {
+		id := gif.String("id")
+		checksum := gif.String("md5")
+		if checksum == "" {
+			report.Skipped = append(report.Skipped, Problem{"gifs", id, "no md5 checksum"})
+			continue
+		}
+		candidates := links[gif.Int("id")]
+		chosen, ok := byID[gif.String("shared_link_id")]
+		if ok {
+			candidates = withLink(candidates, chosen)
+		} else if len(candidates) > 0 {
+			chosen = best(candidates)
+		} else {
+			report.Skipped = append(report.Skipped, Problem{"gifs", id, "no shared link"})
+			continue
+		}
+		if len(candidates) > 1 {
+			report.Conflicts = append(report.Conflicts, Problem{"gifs", id, fmt.Sprintf("%d shared links, kept %v", len(candidates), chosen.id)})
+		}
+		record := gifkv.Record{
+			ID:           checksum,
+			BaseName:     gif.String("basename"),
+			Directory:    gif.String("directory"),
+			FileSize:     int(gif.Int("size")),
+			SharedLinkID: chosen.id,
+			RemotePath:   chosen.remotePath,
+			Count:        chosen.count,
+			CreatedAt:    earliest(parseTime(gif.String("created_at")), chosen.createdAt),
+			UpdatedAt:    latest(parseTime(gif.String("updated_at")), chosen.updatedAt),
+		}
+		if existing, ok := records[checksum]; ok {
+			duplicate := sources[checksum]
+			if better(record, existing) {
+				records[checksum] = record
+				sources[checksum] = id
+			}
+			kept := records[checksum].SharedLinkID
+			report.Conflicts = append(report.Conflicts, Problem{"gifs", id, fmt.Sprintf("md5 %v duplicates gif %v, kept %v", checksum, duplicate, kept)})
+			continue
+		}
+		records[checksum] = record
+		sources[checksum] = id
+	}
+
+	for _, record := range records {
+		report.Records = append(report.Records, record)
+	}
+	sort.Slice(report.Records, func(i, j int) bool {
+		return report.Records[i].ID < report.Records[j].ID
+	})
+	return
+}
+
+// withLink adds the link to the links, unless it's already one of them
+func withLink(links []link, l link) []link {
+	for _, existing := range links {
+		if existing.id == l.id {
+			return links
+		}
+	}
+	return append(links, l)
+}
+
+// best picks the most used link, then the most recently updated
+func best(links []link) link {
+	chosen := links[0]
+	for _, l := range links[1:] {
+		if l.count > chosen.count || (l.count == chosen.count && l.updatedAt.After(chosen.updatedAt)) {
+			chosen = l
+		}
+	}
+	return chosen
+}
+
+// better returns whether a should be kept over b
+func better(a gifkv.Record, b gifkv.Record) bool {
+	if a.Count != b.Count {
+		return a.Count > b.Count
+	}
+	return a.UpdatedAt.After(b.UpdatedAt)
+}
+
+func parseTime(value string) time.Time {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func earliest(a time.Time, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+func latest(a time.Time, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
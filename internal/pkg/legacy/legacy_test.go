@@ -0,0 +1,84 @@
+package legacy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	report, err := Read("fixtures/legacy.db")
+	assert.Nil(t, err)
+	assert.Equal(t, 44, len(report.Records))
+
+	a := report.Records[0]
+	assert.Equal(t, "md5-a", a.ID)
+	assert.Equal(t, "shake it off.gif", a.BaseName)
+	assert.Equal(t, "/taylor swift/dancing", a.Directory)
+	assert.Equal(t, 1234, a.FileSize)
+	assert.Equal(t, "link-a", a.SharedLinkID)
+	assert.Equal(t, "/s/aaa", a.RemotePath)
+	assert.Equal(t, 7, a.Count)
+	zone := time.FixedZone("", -5*60*60)
+	assert.True(t, time.Date(2018, 5, 9, 12, 0, 0, 123456789, zone).Equal(a.CreatedAt))
+	assert.True(t, a.CreatedAt.Equal(a.UpdatedAt))
+
+	b := report.Records[1]
+	assert.Equal(t, "md5-b", b.ID)
+	assert.Equal(t, "link-b2", b.SharedLinkID)
+	assert.Equal(t, "/s/bb2", b.RemotePath)
+	assert.Equal(t, 5, b.Count)
+
+	assert.Equal(t, "md5-f00", report.Records[2].ID)
+	assert.Equal(t, "filler 00.gif", report.Records[2].BaseName)
+
+	// the link a gif names is used, even one that doesn't point back at it
+	g := report.Records[42]
+	assert.Equal(t, "md5-g", g.ID)
+	assert.Equal(t, "link-g", g.SharedLinkID)
+	assert.Equal(t, "/s/ggg", g.RemotePath)
+	assert.Equal(t, 4, g.Count)
+
+	// and wins over a more used link pointing back at it
+	h := report.Records[43]
+	assert.Equal(t, "md5-h", h.ID)
+	assert.Equal(t, "link-h1", h.SharedLinkID)
+	assert.Equal(t, "/s/hh1", h.RemotePath)
+	assert.Equal(t, 1, h.Count)
+
+	var skipped []string
+	for _, p := range report.Skipped {
+		skipped = append(skipped, p.String())
+	}
+	assert.Equal(t, []string{
+		"shared_links link-orphan: no gif with id 999",
+		"gifs 3: no shared link",
+		"gifs 4: no md5 checksum",
+	}, skipped)
+
+	var conflicts []string
+	for _, p := range report.Conflicts {
+		conflicts = append(conflicts, p.String())
+	}
+	assert.Equal(t, []string{
+		"gifs 2: 2 shared links, kept link-b2",
+		"gifs 5: md5 md5-a duplicates gif 1, kept link-a",
+		"gifs 47: 2 shared links, kept link-h1",
+	}, conflicts)
+}
+
+func TestReadInvalid(t *testing.T) {
+	_, err := Read("fixtures/missing.db")
+	assert.NotNil(t, err)
+
+	_, err = Read("../sqlite/fixtures/test.db")
+	assert.NotNil(t, err)
+	assert.Equal(t, "no such table: gifs", err.Error())
+}
+
+func TestParseTime(t *testing.T) {
+	assert.True(t, time.Date(2018, 5, 9, 12, 0, 0, 0, time.UTC).Equal(parseTime("2018-05-09 12:00:00")))
+	assert.True(t, time.Date(2018, 5, 9, 0, 0, 0, 0, time.UTC).Equal(parseTime("2018-05-09")))
+	assert.True(t, parseTime("yesterday").IsZero())
+}
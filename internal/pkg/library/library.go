@@ -0,0 +1,143 @@
+package library
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/data"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+// Gif is a gif found in the local library
+type Gif struct {
+	Path     string
+	Checksum string
+	Err      error
+}
+
+// Report breaks the local library down by its link status
+type Report struct {
+	Cached   []Gif
+	Unlinked []Gif
+	Failed   []Gif
+	Missing  []gifkv.Record
+}
+
+// Scan walks the root for gifs and checksums them, each using a pool of workers.
+// A root without any gifs is an empty library, not an error.
+func Scan(root string, workers int) (gifs []Gif, err error) {
+	handler := data.NewHandler()
+	paths, err := walk(root, workers)
+	if err != nil {
+		return
+	}
+	gifs = make([]Gif, len(paths))
+	for i, path := range paths {
+		gifs[i].Path = path
+	}
+	Each(len(gifs), workers, func(i int) {
+		gifs[i].Checksum, gifs[i].Err = handler.MD5Checksum(gifs[i].Path)
+	})
+	return
+}
+
+// walk returns every gif in the directory tree in order, reading at most the
+// given number of directories at once. Hidden directories are skipped.
+func walk(root string, workers int) (paths []string, err error) {
+	if workers < 1 {
+		workers = 1
+	}
+	var mutex sync.Mutex
+	var pending sync.WaitGroup
+	reading := make(chan bool, workers)
+	var read func(dir string)
+	read = func(dir string) {
+		defer pending.Done()
+		reading <- true
+		entries, readErr := ioutil.ReadDir(dir)
+		<-reading
+		var gifs []string
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			switch {
+			case entry.IsDir():
+				if !strings.HasPrefix(entry.Name(), ".") {
+					pending.Add(1)
+					go read(path)
+				}
+			case strings.HasSuffix(strings.ToLower(entry.Name()), ".gif"):
+				gifs = append(gifs, path)
+			}
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		paths = append(paths, gifs...)
+		if readErr != nil && err == nil {
+			err = readErr
+		}
+	}
+	pending.Add(1)
+	go read(root)
+	pending.Wait()
+	sort.Strings(paths)
+	return
+}
+
+// Compare sorts the scanned gifs by whether they have a cached record, and
+// finds the records whose files no longer exist under the root
+func Compare(root string, gifs []Gif, records []gifkv.Record) (report Report) {
+	cached := make(map[string]bool)
+	for _, r := range records {
+		cached[r.ID] = true
+		if _, err := os.Stat(LocalPath(root, r)); os.IsNotExist(err) {
+			report.Missing = append(report.Missing, r)
+		}
+	}
+	for _, gif := range gifs {
+		switch {
+		case gif.Err != nil:
+			report.Failed = append(report.Failed, gif)
+		case cached[gif.Checksum]:
+			report.Cached = append(report.Cached, gif)
+		default:
+			report.Unlinked = append(report.Unlinked, gif)
+		}
+	}
+	sort.Slice(report.Missing, func(i, j int) bool {
+		return LocalPath(root, report.Missing[i]) < LocalPath(root, report.Missing[j])
+	})
+	return
+}
+
+// LocalPath returns where the record's gif lives under the root
+func LocalPath(root string, r gifkv.Record) string {
+	return filepath.Join(root, r.Directory, r.BaseName)
+}
+
+// Each calls fn with every index from 0 to n, using at most the given number
+// of concurrent workers
+func Each(n int, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,85 @@
+package library
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+func fixturesPath() string {
+	workingDir, _ := os.Getwd()
+	return filepath.Join(workingDir, "..", "data", "fixtures", "gifs")
+}
+
+func TestScan(t *testing.T) {
+	assert := assert.New(t)
+
+	gifs, err := Scan(fixturesPath(), 2)
+	assert.Nil(err)
+	assert.Equal(3, len(gifs))
+	assert.Equal(filepath.Join(fixturesPath(), "nested", "three four.gif"), gifs[0].Path)
+	assert.Equal(filepath.Join(fixturesPath(), "one.gif"), gifs[1].Path)
+	assert.Equal("a3e548e3c26d649d9f7a0bdeac7c9de1", gifs[1].Checksum)
+	assert.Nil(gifs[1].Err)
+
+	_, err = Scan(filepath.Join(fixturesPath(), "missing"), 2)
+	assert.NotNil(err)
+
+	// a folder whose gifs have all been deleted still scans, so its records show up as missing
+	empty, _ := ioutil.TempDir("", "library")
+	defer os.RemoveAll(empty)
+	os.Mkdir(filepath.Join(empty, ".hidden"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(empty, ".hidden", "skipped.gif"), []byte{}, 0600)
+	gifs, err = Scan(empty, 2)
+	assert.Nil(err)
+	assert.Empty(gifs)
+	report := Compare(empty, gifs, []gifkv.Record{{ID: "gone", BaseName: "gone.gif", Directory: "/"}})
+	assert.Equal(1, len(report.Missing))
+}
+
+func TestCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	gifs := []Gif{
+		{Path: filepath.Join(fixturesPath(), "one.gif"), Checksum: "one"},
+		{Path: filepath.Join(fixturesPath(), "two.gif"), Checksum: "two"},
+		{Path: filepath.Join(fixturesPath(), "bad.gif"), Err: os.ErrPermission},
+	}
+	records := []gifkv.Record{
+		{ID: "one", BaseName: "one.gif", Directory: "/"},
+		{ID: "gone", BaseName: "gone.gif", Directory: "/nested"},
+	}
+
+	report := Compare(fixturesPath(), gifs, records)
+	assert.Equal([]Gif{gifs[0]}, report.Cached)
+	assert.Equal([]Gif{gifs[1]}, report.Unlinked)
+	assert.Equal([]Gif{gifs[2]}, report.Failed)
+	assert.Equal([]gifkv.Record{records[1]}, report.Missing)
+}
+
+func TestLocalPath(t *testing.T) {
+	r := gifkv.Record{BaseName: "shake it off.gif", Directory: "/taylor swift"}
+	assert.Equal(t, "/my/gifs/taylor swift/shake it off.gif", LocalPath("/my/gifs", r))
+}
+
+func TestEach(t *testing.T) {
+	var mutex sync.Mutex
+	seen := make(map[int]bool)
+	Each(10, 3, func(i int) {
+		mutex.Lock()
+		seen[i] = true
+		mutex.Unlock()
+	})
+	assert.Equal(t, 10, len(seen))
+
+	count := 0
+	Each(2, 0, func(i int) {
+		count++
+	})
+	assert.Equal(t, 2, count)
+}
@@ -16,9 +16,9 @@ func Goodbye() string {
 	return fmt.Sprintf("%v %v %v", heart(), color.Blue("Goodbye"), heart())
 }
 
-// AwaitingInput returns an informational message
-func AwaitingInput(mode string) string {
-	return fmt.Sprintf("%v %v %v%v", heart(), color.LightPurple("Waiting for input"), heart(), CurrentMode(mode))
+// AwaitingInput returns an informational message, with the profile when one is in use
+func AwaitingInput(mode string, profile string) string {
+	return fmt.Sprintf("%v %v %v%v%v", heart(), color.LightPurple("Waiting for input"), heart(), CurrentMode(mode), CurrentProfile(profile))
 }
 
 // CurrentMode returns the current mode
@@ -26,6 +26,14 @@ func CurrentMode(mode string) string {
 	return fmt.Sprintf("%v%v %v %v", spacing(), note(), color.Blue(mode), note())
 }
 
+// CurrentProfile returns the current profile, or nothing without one
+func CurrentProfile(profile string) string {
+	if profile == "" {
+		return ""
+	}
+	return fmt.Sprintf("   %v %v %v", folder(), color.Blue(profile), folder())
+}
+
 // ModeShift returns the mode shifted to
 func ModeShift(mode string) string {
 	return color.Blue(fmt.Sprintf("🎵 mode shifted to %v 🎵", mode))
@@ -78,6 +86,10 @@ func cheer() string {
 	return "🎉"
 }
 
+func folder() string {
+	return "🗂"
+}
+
 func note() string {
 	return "🎵"
 }
@@ -46,15 +46,27 @@ func TestModeShift(t *testing.T) {
 func TestAwaitingInput(t *testing.T) {
 	assert := assert.New(t)
 
-	received := AwaitingInput("url")
+	received := AwaitingInput("url", "")
 	expected := "💖 \x1b[0;95mWaiting for input\x1b[0m 💖             🎵 \x1b[0;34murl\x1b[0m 🎵"
 
 	assert.Equal(expected, received)
 
-	received = AwaitingInput("md")
+	received = AwaitingInput("md", "")
 	expected = "💖 \x1b[0;95mWaiting for input\x1b[0m 💖             🎵 \x1b[0;34mmd\x1b[0m 🎵"
 
 	assert.Equal(expected, received)
+
+	received = AwaitingInput("md", "work")
+	expected = "💖 \x1b[0;95mWaiting for input\x1b[0m 💖             🎵 \x1b[0;34mmd\x1b[0m 🎵   🗂 \x1b[0;34mwork\x1b[0m 🗂"
+
+	assert.Equal(expected, received)
+}
+
+func TestCurrentProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", CurrentProfile(""))
+	assert.Equal("   🗂 \x1b[0;34mwork\x1b[0m 🗂", CurrentProfile("work"))
 }
 
 func TestCurrentMode(t *testing.T) {
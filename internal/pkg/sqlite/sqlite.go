@@ -0,0 +1,438 @@
+// Package sqlite reads tables from SQLite 3 database files without cgo.
+//
+// It only supports what is needed to recover data: UTF-8 databases, rowid
+// tables, and files that were closed cleanly (a pending -wal journal is ignored).
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+const headerSize = 100
+
+var magic = []byte("SQLite format 3\x00")
+
+// page types
+const (
+	interiorTable = 0x05
+	leafTable     = 0x0d
+)
+
+// DB is a SQLite database file loaded into memory
+type DB struct {
+	data       []byte
+	pageSize   int
+	usableSize int
+	tables     map[string]table
+}
+
+type table struct {
+	name     string
+	rootPage int
+	columns  []string
+	rowidCol int
+}
+
+// Row maps column names to values: nil, int64, float64, string, or []byte
+type Row map[string]interface{}
+
+// String returns the column as a string, or "" when it is NULL
+func (r Row) String(column string) string {
+	switch v := r[column].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return fmt.Sprint(v)
+	case float64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Int returns the column as an integer, or 0 when it is NULL or not a number
+func (r Row) Int(column string) int64 {
+	switch v := r[column].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// Float returns the column as a float, or 0 when it is NULL or not a number.
+// SQLite stores whole REAL values as integers, so prefer it for REAL columns.
+func (r Row) Float(column string) float64 {
+	switch v := r[column].(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// Open reads the database file at path
+func Open(path string) (*DB, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+func parse(data []byte) (db *DB, err error) {
+	if len(data) < headerSize || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, errors.New("not a SQLite 3 database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+	if encoding := binary.BigEndian.Uint32(data[56:60]); encoding > 1 {
+		return nil, errors.New("only UTF-8 databases are supported")
+	}
+	db = &DB{
+		data:       data,
+		pageSize:   pageSize,
+		usableSize: pageSize - int(data[20]),
+		tables:     make(map[string]table),
+	}
+	master := table{name: "sqlite_master", rootPage: 1, columns: []string{"type", "name", "tbl_name", "rootpage", "sql"}, rowidCol: -1}
+	rows, err := db.rows(master)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the schema: %v", err)
+	}
+	for _, row := range rows {
+		if row.String("type") != "table" {
+			continue
+		}
+		columns, rowidCol := parseColumns(row.String("sql"))
+		name := row.String("name")
+		db.tables[strings.ToLower(name)] = table{name: name, rootPage: int(row.Int("rootpage")), columns: columns, rowidCol: rowidCol}
+	}
+	return
+}
+
+// Tables returns the name of every table
+func (db *DB) Tables() (names []string) {
+	for _, t := range db.tables {
+		names = append(names, t.name)
+	}
+	return
+}
+
+// Columns returns the column names of the table, in order
+func (db *DB) Columns(name string) ([]string, error) {
+	t, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("no such table: %v", name)
+	}
+	return t.columns, nil
+}
+
+// Rows returns every row of the table, in rowid order
+func (db *DB) Rows(name string) ([]Row, error) {
+	t, ok := db.tables[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("no such table: %v", name)
+	}
+	return db.rows(t)
+}
+
+func (db *DB) rows(t table) (rows []Row, err error) {
+	err = db.walk(t.rootPage, 0, func(rowid int64, values []interface{}) {
+		row := make(Row, len(t.columns))
+		for i, column := range t.columns {
+			if i == t.rowidCol {
+				row[column] = rowid
+			} else if i < len(values) {
+				row[column] = values[i]
+			} else {
+				row[column] = nil
+			}
+		}
+		rows = append(rows, row)
+	})
+	return
+}
+
+func (db *DB) page(number int) ([]byte, error) {
+	start := (number - 1) * db.pageSize
+	if number < 1 || start+db.pageSize > len(db.data) {
+		return nil, fmt.Errorf("page %d is out of range", number)
+	}
+	return db.data[start : start+db.pageSize], nil
+}
+
+// walk visits every cell in the table b-tree rooted at the page
+func (db *DB) walk(number int, depth int, fn func(rowid int64, values []interface{})) error {
+	if depth > 64 {
+		return errors.New("the table b-tree is too deep")
+	}
+	page, err := db.page(number)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	if number == 1 {
+		offset = headerSize
+	}
+	kind := page[offset]
+	cells := int(binary.BigEndian.Uint16(page[offset+3 : offset+5]))
+	switch kind {
+	case interiorTable:
+		pointers := offset + 12
+		for i := 0; i < cells; i++ {
+			cell := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+			if cell+4 > len(page) {
+				return fmt.Errorf("page %d is corrupt", number)
+			}
+			if err := db.walk(int(binary.BigEndian.Uint32(page[cell:])), depth+1, fn); err != nil {
+				return err
+			}
+		}
+		return db.walk(int(binary.BigEndian.Uint32(page[offset+8:])), depth+1, fn)
+	case leafTable:
+		pointers := offset + 8
+		for i := 0; i < cells; i++ {
+			cell := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+			rowid, payload, err := db.cell(page, cell)
+			if err != nil {
+				return fmt.Errorf("page %d: %v", number, err)
+			}
+			values, err := record(payload)
+			if err != nil {
+				return fmt.Errorf("page %d: %v", number, err)
+			}
+			fn(rowid, values)
+		}
+		return nil
+	}
+	return fmt.Errorf("page %d is not a table page", number)
+}
+
+// cell returns the rowid and the full payload of a leaf table cell,
+// following overflow pages as needed
+func (db *DB) cell(page []byte, offset int) (rowid int64, payload []byte, err error) {
+	if offset >= len(page) {
+		return 0, nil, errors.New("cell out of range")
+	}
+	size, n := varint(page[offset:])
+	offset += n
+	id, n := varint(page[offset:])
+	offset += n
+	rowid = int64(id)
+
+	total := int(size)
+	local := db.localSize(total)
+	if offset+local > len(page) {
+		return 0, nil, errors.New("cell out of range")
+	}
+	payload = make([]byte, 0, total)
+	payload = append(payload, page[offset:offset+local]...)
+	if local == total {
+		return
+	}
+	if offset+local+4 > len(page) {
+		return 0, nil, errors.New("cell out of range")
+	}
+	next := int(binary.BigEndian.Uint32(page[offset+local:]))
+	for len(payload) < total {
+		overflow, err := db.page(next)
+		if err != nil {
+			return 0, nil, err
+		}
+		chunk := overflow[4:db.usableSize]
+		if remaining := total - len(payload); remaining < len(chunk) {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+		next = int(binary.BigEndian.Uint32(overflow))
+	}
+	return
+}
+
+// localSize returns how much of a payload is stored on the leaf page itself
+func (db *DB) localSize(total int) int {
+	max := db.usableSize - 35
+	if total <= max {
+		return total
+	}
+	min := (db.usableSize-12)*32/255 - 23
+	local := min + (total-min)%(db.usableSize-4)
+	if local > max {
+		return min
+	}
+	return local
+}
+
+// record decodes a record payload into its values
+func record(payload []byte) (values []interface{}, err error) {
+	headerLength, n := varint(payload)
+	if n == 0 || int(headerLength) > len(payload) {
+		return nil, errors.New("invalid record header")
+	}
+	var types []uint64
+	for offset := n; offset < int(headerLength); {
+		t, n := varint(payload[offset:headerLength])
+		if n == 0 {
+			return nil, errors.New("invalid record header")
+		}
+		types = append(types, t)
+		offset += n
+	}
+	body := payload[headerLength:]
+	for _, t := range types {
+		size := serialSize(t)
+		if size > len(body) {
+			return nil, errors.New("record is truncated")
+		}
+		values = append(values, value(t, body[:size]))
+		body = body[size:]
+	}
+	return
+}
+
+func serialSize(t uint64) int {
+	switch {
+	case t <= 4:
+		return int(t)
+	case t == 5:
+		return 6
+	case t == 6 || t == 7:
+		return 8
+	case t < 12:
+		return 0
+	case t%2 == 0:
+		return int(t-12) / 2
+	}
+	return int(t-13) / 2
+}
+
+func value(t uint64, data []byte) interface{} {
+	switch {
+	case t == 0:
+		return nil
+	case t <= 6:
+		// big-endian two's complement of the serial size
+		var v int64
+		if data[0]&0x80 != 0 {
+			v = -1
+		}
+		for _, b := range data {
+			v = v<<8 | int64(b)
+		}
+		return v
+	case t == 7:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	case t == 8:
+		return int64(0)
+	case t == 9:
+		return int64(1)
+	case t >= 12 && t%2 == 0:
+		return append([]byte(nil), data...)
+	case t >= 13:
+		return string(data)
+	}
+	return nil
+}
+
+// varint decodes a SQLite variable-length integer, returning it and the number of
+// bytes read (0 when the data is too short)
+func varint(data []byte) (v uint64, n int) {
+	for i := 0; i < 9; i++ {
+		if i >= len(data) {
+			return 0, 0
+		}
+		if i == 8 {
+			return v<<8 | uint64(data[i]), 9
+		}
+		v = v<<7 | uint64(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return
+}
+
+// parseColumns pulls the column names out of a CREATE TABLE statement, along with
+// the index of the INTEGER PRIMARY KEY column that aliases the rowid (or -1)
+func parseColumns(sql string) (columns []string, rowidCol int) {
+	rowidCol = -1
+	start := strings.Index(sql, "(")
+	end := strings.LastIndex(sql, ")")
+	if start < 0 || end <= start {
+		return
+	}
+	for _, definition := range splitDefinitions(sql[start+1 : end]) {
+		fields := strings.Fields(definition)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CONSTRAINT", "PRIMARY", "FOREIGN", "UNIQUE", "CHECK":
+			continue
+		}
+		upper := strings.ToUpper(strings.Join(fields[1:], " "))
+		if strings.HasPrefix(upper, "INTEGER PRIMARY KEY") && !strings.Contains(upper, "DESC") {
+			rowidCol = len(columns)
+		}
+		columns = append(columns, unquote(fields[0]))
+	}
+	return
+}
+
+// splitDefinitions splits on the commas that are not inside parentheses or quotes
+func splitDefinitions(body string) (definitions []string) {
+	depth := 0
+	var quote rune
+	start := 0
+	for i, c := range body {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			definitions = append(definitions, body[start:i])
+			start = i + 1
+		}
+	}
+	return append(definitions, body[start:])
+}
+
+func unquote(name string) string {
+	if len(name) >= 2 {
+		switch name[0] {
+		case '"', '\'', '`':
+			if name[len(name)-1] == name[0] {
+				return name[1 : len(name)-1]
+			}
+		case '[':
+			if name[len(name)-1] == ']' {
+				return name[1 : len(name)-1]
+			}
+		}
+	}
+	return name
+}
@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen(t *testing.T) {
+	db, err := Open("fixtures/test.db")
+	assert.Nil(t, err)
+	assert.Equal(t, 512, db.pageSize)
+	tables := db.Tables()
+	sort.Strings(tables)
+	assert.Equal(t, []string{"notes", "sqlite_sequence", "things"}, tables)
+
+	_, err = Open("fixtures/missing.db")
+	assert.NotNil(t, err)
+
+	file, _ := ioutil.TempFile("", "sqlite")
+	file.WriteString(strings.Repeat("not a database", 10))
+	file.Close()
+	defer os.Remove(file.Name())
+	_, err = Open(file.Name())
+	assert.NotNil(t, err)
+	assert.Equal(t, "not a SQLite 3 database", err.Error())
+}
+
+func TestColumns(t *testing.T) {
+	db, _ := Open("fixtures/test.db")
+
+	columns, err := db.Columns("things")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "name", "amount", "ratio", "data"}, columns)
+
+	_, err = db.Columns("gifs")
+	assert.NotNil(t, err)
+	assert.Equal(t, "no such table: gifs", err.Error())
+}
+
+func TestRows(t *testing.T) {
+	db, _ := Open("fixtures/test.db")
+
+	rows, err := db.Rows("THINGS")
+	assert.Nil(t, err)
+	assert.Equal(t, 101, len(rows))
+	for i, row := range rows[:100] {
+		n := int64(i + 1)
+		assert.Equal(t, n, row.Int("id"))
+		assert.Equal(t, "thing "+row.String("id"), row.String("name"))
+		if n%2 == 1 {
+			assert.Equal(t, -n*1000, row.Int("amount"))
+		} else {
+			assert.Equal(t, n*1000, row.Int("amount"))
+		}
+		assert.Equal(t, float64(n)/4, row.Float("ratio"))
+		assert.Equal(t, []byte{byte(n), 0, 255}, row["data"])
+	}
+
+	big := rows[100]
+	assert.Equal(t, "big "+strings.Repeat("x", 3000), big.String("name"))
+	assert.Equal(t, int64(9007199254740993), big.Int("amount"))
+	assert.Nil(t, big["ratio"])
+	assert.Equal(t, "", big.String("data"))
+
+	rows, err = db.Rows("notes")
+	assert.Nil(t, err)
+	assert.Equal(t, []Row{{"body": "hello"}}, rows)
+
+	_, err = db.Rows("gifs")
+	assert.NotNil(t, err)
+}
+
+func TestVarint(t *testing.T) {
+	v, n := varint([]byte{0x7f})
+	assert.Equal(t, uint64(127), v)
+	assert.Equal(t, 1, n)
+
+	v, n = varint([]byte{0x81, 0x00})
+	assert.Equal(t, uint64(128), v)
+	assert.Equal(t, 2, n)
+
+	v, n = varint([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.Equal(t, ^uint64(0), v)
+	assert.Equal(t, 9, n)
+
+	_, n = varint([]byte{0x81})
+	assert.Equal(t, 0, n)
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, rowid := parseColumns(`CREATE TABLE "shared_links" ("id" varchar NOT NULL PRIMARY KEY, "gif_id" integer, "count" integer DEFAULT 0, CONSTRAINT "fk"
+FOREIGN KEY ("gif_id")
+  REFERENCES "gifs" ("id")
+)`)
+	assert.Equal(t, []string{"id", "gif_id", "count"}, columns)
+	assert.Equal(t, -1, rowid)
+
+	columns, rowid = parseColumns("CREATE TABLE t ([a b] text, `c` INTEGER PRIMARY KEY, d numeric(10, 2), PRIMARY KEY (c))")
+	assert.Equal(t, []string{"[a", "c", "d"}, columns)
+	assert.Equal(t, 1, rowid)
+}
@@ -0,0 +1,142 @@
+// Package verify checks that the public links of cached gifs still work
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/httpclient"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/library"
+)
+
+// Status classifies the answer for a link
+type Status string
+
+// Statuses, in the order they are summarized
+const (
+	OK           Status = "ok"
+	Gone         Status = "gone"
+	RateLimited  Status = "rate-limited"
+	NetworkError Status = "network error"
+	Unexpected   Status = "unexpected"
+)
+
+// Statuses lists every status, in the order they are summarized
+var Statuses = []Status{OK, Gone, RateLimited, NetworkError, Unexpected}
+
+// Result is the outcome of checking a record's link
+type Result struct {
+	Record gifkv.Record
+	Status Status
+	Code   int
+	Err    error
+}
+
+// String returns a formatted result
+func (r Result) String() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("%v (%v)", r.Record.BaseName, r.Err)
+	case r.Code != 0:
+		return fmt.Sprintf("%v (%d)", r.Record.BaseName, r.Code)
+	}
+	return r.Record.BaseName
+}
+
+// Check sends a HEAD request for the record's link and classifies the answer.
+// Server errors are grouped with network errors, as both are worth retrying later.
+func Check(client httpclient.Doer, r gifkv.Record) Result {
+	return CheckContext(context.Background(), client, r)
+}
+
+// CheckContext is Check, giving up on the request when the context is done
+func CheckContext(ctx context.Context, client httpclient.Doer, r gifkv.Record) (result Result) {
+	result.Record = r
+	if r.URL() == "" {
+		result.Status = Unexpected
+		result.Err = errors.New("empty url")
+		return
+	}
+	req, err := http.NewRequest(http.MethodHead, r.URL(), nil)
+	if err != nil {
+		result.Status = Unexpected
+		result.Err = err
+		return
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		result.Status = NetworkError
+		result.Err = err
+		return
+	}
+	resp.Body.Close()
+	result.Code = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		result.Status = OK
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		result.Status = Gone
+	case resp.StatusCode == http.StatusTooManyRequests:
+		result.Status = RateLimited
+	case resp.StatusCode >= 500:
+		result.Status = NetworkError
+	default:
+		result.Status = Unexpected
+	}
+	return
+}
+
+// Run checks every record, with up to workers checks at once. The results are
+// in the same order as the records.
+func Run(client httpclient.Doer, records []gifkv.Record, workers int) []Result {
+	return RunContext(context.Background(), client, records, workers)
+}
+
+// RunContext is Run, giving up on the checks left when the context is done
+func RunContext(ctx context.Context, client httpclient.Doer, records []gifkv.Record, workers int) []Result {
+	results := make([]Result, len(records))
+	library.Each(len(records), workers, func(i int) {
+		results[i] = CheckContext(ctx, client, records[i])
+	})
+	return results
+}
+
+// Summary groups the results by status
+type Summary map[Status][]Result
+
+// Summarize groups the results by status
+func Summarize(results []Result) Summary {
+	summary := make(Summary)
+	for _, result := range results {
+		summary[result.Status] = append(summary[result.Status], result)
+	}
+	return summary
+}
+
+// Dead returns the records whose links are gone
+func (s Summary) Dead() (records []gifkv.Record) {
+	for _, result := range s[Gone] {
+		records = append(records, result.Record)
+	}
+	return
+}
+
+// String returns the count for each status, listing the links that are not ok
+func (s Summary) String() string {
+	var lines []string
+	for _, status := range Statuses {
+		label := strings.ToUpper(string(status[:1])) + string(status[1:]) + ":"
+		lines = append(lines, fmt.Sprintf("%-15v%d", label, len(s[status])))
+		if status == OK {
+			continue
+		}
+		for _, result := range s[status] {
+			lines = append(lines, fmt.Sprintf("  %v", result))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,129 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trueheart78/dropbox-gif-linker/internal/pkg/gifkv"
+)
+
+func server() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "ok"):
+			w.WriteHeader(http.StatusOK)
+		case strings.Contains(r.URL.Path, "gone"):
+			w.WriteHeader(http.StatusNotFound)
+		case strings.Contains(r.URL.Path, "removed"):
+			w.WriteHeader(http.StatusGone)
+		case strings.Contains(r.URL.Path, "busy"):
+			w.WriteHeader(http.StatusTooManyRequests)
+		case strings.Contains(r.URL.Path, "failing"):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+}
+
+// client sends every request to the test server, whatever the host
+func client(ts *httptest.Server) *http.Client {
+	c := ts.Client()
+	transport := c.Transport
+	c.Transport = roundTripper(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme, r.URL.Host = "http", strings.TrimPrefix(ts.URL, "http://")
+		return transport.RoundTrip(r)
+	})
+	return c
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func record(name string, remotePath string) gifkv.Record {
+	return gifkv.Record{ID: name, BaseName: name + ".gif", RemotePath: remotePath}
+}
+
+func TestCheck(t *testing.T) {
+	assert := assert.New(t)
+	ts := server()
+	defer ts.Close()
+
+	tests := map[string]Status{
+		"ok":      OK,
+		"gone":    Gone,
+		"removed": Gone,
+		"busy":    RateLimited,
+		"failing": NetworkError,
+		"private": Unexpected,
+	}
+	for name, status := range tests {
+		result := Check(client(ts), record(name, "/s/abc"))
+		assert.Equal(status, result.Status, name)
+		assert.Equal(name, result.Record.ID)
+		assert.Nil(result.Err)
+	}
+}
+
+func TestCheckNetworkError(t *testing.T) {
+	assert := assert.New(t)
+	ts := server()
+	ts.Close()
+
+	result := Check(http.DefaultClient, record("ok", "/s/abc"))
+	assert.Equal(NetworkError, result.Status)
+	assert.NotNil(result.Err)
+	assert.Equal(0, result.Code)
+}
+
+func TestRunCancelled(t *testing.T) {
+	assert := assert.New(t)
+	ts := server()
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := RunContext(ctx, client(ts), []gifkv.Record{record("ok-1", "/s/a"), record("ok-2", "/s/b")}, 2)
+	for _, result := range results {
+		assert.Equal(NetworkError, result.Status)
+		assert.True(errors.Is(result.Err, context.Canceled))
+	}
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+	ts := server()
+	defer ts.Close()
+
+	records := []gifkv.Record{
+		record("ok-1", "/s/a"), record("gone-1", "/s/b"), record("ok-2", "/s/c"),
+		record("busy-1", "/s/d"), record("ok-3", "/s/e"), record("removed-1", "/s/f"),
+	}
+	results := Run(client(ts), records, 3)
+	assert.Len(results, len(records))
+	for i, result := range results {
+		assert.Equal(records[i].ID, result.Record.ID)
+	}
+
+	summary := Summarize(results)
+	assert.Len(summary[OK], 3)
+	assert.Len(summary[Gone], 2)
+	assert.Len(summary[RateLimited], 1)
+	assert.Empty(summary[NetworkError])
+	assert.Equal([]gifkv.Record{records[1], records[5]}, summary.Dead())
+
+	output := summary.String()
+	assert.Contains(output, "Ok:            3")
+	assert.Contains(output, "Gone:          2\n  gone-1.gif (404)\n  removed-1.gif (410)")
+	assert.Contains(output, "Rate-limited:  1\n  busy-1.gif (429)")
+	assert.Contains(output, "Network error: 0")
+	assert.NotContains(output, "ok-1.gif")
+}